@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	. "github.com/mohamed2394/goserver/internal"
+	"github.com/mohamed2394/goserver/internal/auth"
+)
+
+// principal is the authenticated user a request is made on behalf of
+type principal struct {
+	UserId int
+	// Token holds the verified claims of the access token the request carried
+	Token auth.Claims
+}
+
+type principalKey struct{}
+
+// RequireAuth only lets requests with a valid Bearer token through to next,
+// with their principal stored in the request context
+func (cfg *apiConfig) RequireAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p, err := cfg.authenticate(r)
+		if err != nil {
+			RespondWithError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		next(w, withPrincipal(r, p))
+	}
+}
+
+// OptionalAuth lets anonymous requests through to next without a principal.
+// A token that is present but invalid is still rejected.
+func (cfg *apiConfig) OptionalAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			next(w, r)
+			return
+		}
+		cfg.RequireAuth(next)(w, r)
+	}
+}
+
+func withPrincipal(r *http.Request, p principal) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), principalKey{}, p))
+}
+
+// principalFrom returns the principal stored by RequireAuth or OptionalAuth,
+// and false for anonymous requests
+func principalFrom(ctx context.Context) (principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(principal)
+	return p, ok
+}
+
+// currentUserId returns the id of the authenticated user of r, or 0 for an
+// anonymous request
+func currentUserId(r *http.Request) int {
+	p, _ := principalFrom(r.Context())
+	return p.UserId
+}
+
+// authenticate validates the Bearer token of the request and returns the
+// principal it was issued to
+func (cfg *apiConfig) authenticate(r *http.Request) (principal, error) {
+	token, err := bearerToken(r)
+	if err != nil {
+		return principal{}, err
+	}
+
+	claims, err := cfg.verifier.Verify(token)
+	if err != nil {
+		return principal{}, errors.New("Invalid or expired token")
+	}
+	if cfg.revocations.Revoked(claims) {
+		return principal{}, errors.New("Token has been revoked")
+	}
+	return principal{UserId: claims.UserId, Token: claims}, nil
+}
+
+// issueAccessToken returns a new access token for userId at their current
+// token version that is valid for ttl
+func (cfg *apiConfig) issueAccessToken(userId int, ttl time.Duration) (string, auth.Claims, error) {
+	return cfg.issuer.Issue(userId, cfg.revocations.Version(userId), ttl)
+}
+
+// bearerToken returns the token of the request's Bearer Authorization header
+func bearerToken(r *http.Request) (string, error) {
+	authHeader := r.Header.Get("Authorization")
+	if !strings.HasPrefix(authHeader, "Bearer ") {
+		return "", errors.New("Authorization header missing or malformed")
+	}
+	return strings.TrimPrefix(authHeader, "Bearer "), nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	. "github.com/mohamed2394/goserver/internal"
+	. "github.com/mohamed2394/goserver/internal/database"
+)
+
+func (uh *userHandler) blockUserHandler(w http.ResponseWriter, r *http.Request) {
+	uh.changeRelation(w, r, uh.db.Block)
+}
+
+func (uh *userHandler) unblockUserHandler(w http.ResponseWriter, r *http.Request) {
+	uh.changeRelation(w, r, uh.db.Unblock)
+}
+
+func (uh *userHandler) muteUserHandler(w http.ResponseWriter, r *http.Request) {
+	uh.changeRelation(w, r, uh.db.Mute)
+}
+
+func (uh *userHandler) unmuteUserHandler(w http.ResponseWriter, r *http.Request) {
+	uh.changeRelation(w, r, uh.db.Unmute)
+}
+
+// changeRelation applies change from the authenticated user to the user in the path
+func (uh *userHandler) changeRelation(w http.ResponseWriter, r *http.Request, change func(userId, otherId int) error) {
+	userId := currentUserId(r)
+
+	otherId, err := strconv.Atoi(r.PathValue("USERID"))
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	err = change(userId, otherId)
+	switch {
+	case errors.Is(err, ErrSelfRelation):
+		RespondWithError(w, http.StatusBadRequest, "You can't block or mute yourself")
+	case errors.Is(err, ErrNotFound):
+		RespondWithError(w, http.StatusNotFound, "User not found")
+	case err != nil:
+		log.Printf("Failed to update relation: %v", err)
+		RespondWithError(w, http.StatusInternalServerError, "Failed to update relation")
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
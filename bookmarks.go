@@ -0,0 +1,175 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	. "github.com/mohamed2394/goserver/internal"
+	. "github.com/mohamed2394/goserver/internal/database"
+)
+
+// maxPinnedChirps is how many chirps a user can pin to their profile
+const maxPinnedChirps = 3
+
+func (ch *chirpHandler) bookmarkChirpHandler(w http.ResponseWriter, r *http.Request) {
+	userId := currentUserId(r)
+
+	id, err := strconv.Atoi(r.PathValue("CHIRPID"))
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid chirp ID")
+		return
+	}
+
+	viewer, err := ch.newViewer(userId)
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to load chirp")
+		return
+	}
+	chirp, err := ch.db.GetChirp(id)
+	if err != nil || !viewer.canSee(chirp) {
+		RespondWithError(w, http.StatusNotFound, "Chirp not found")
+		return
+	}
+
+	err = ch.db.AddBookmark(userId, id)
+	if errors.Is(err, ErrNotFound) {
+		RespondWithError(w, http.StatusNotFound, "Chirp not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to bookmark chirp: %v", err)
+		RespondWithError(w, http.StatusInternalServerError, "Failed to bookmark chirp")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (ch *chirpHandler) unbookmarkChirpHandler(w http.ResponseWriter, r *http.Request) {
+	userId := currentUserId(r)
+
+	id, err := strconv.Atoi(r.PathValue("CHIRPID"))
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid chirp ID")
+		return
+	}
+
+	err = ch.db.RemoveBookmark(userId, id)
+	if errors.Is(err, ErrNotFound) {
+		RespondWithError(w, http.StatusNotFound, "Bookmark not found")
+		return
+	}
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to remove bookmark")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (ch *chirpHandler) getBookmarksHandler(w http.ResponseWriter, r *http.Request) {
+	userId := currentUserId(r)
+	page, err := parsePage(r)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	viewer, err := ch.newViewer(userId)
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to load bookmarks")
+		return
+	}
+	bookmarks, err := ch.db.GetBookmarks(userId)
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to load bookmarks")
+		return
+	}
+
+	// A bookmarked chirp can stop being visible, e.g. if it is made private
+	visible := []Bookmark{}
+	for _, bookmark := range bookmarks {
+		if viewer.canSee(bookmark.Chirp) {
+			visible = append(visible, bookmark)
+		}
+	}
+
+	RespondWithJSON(w, http.StatusOK, paginate(visible, page))
+}
+
+func (ch *chirpHandler) pinChirpHandler(w http.ResponseWriter, r *http.Request) {
+	userId := currentUserId(r)
+
+	id, err := strconv.Atoi(r.PathValue("CHIRPID"))
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid chirp ID")
+		return
+	}
+
+	err = ch.db.PinChirp(userId, id, maxPinnedChirps)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		RespondWithError(w, http.StatusNotFound, "Chirp not found")
+	case errors.Is(err, ErrNotChirpAuthor):
+		RespondWithError(w, http.StatusForbidden, "You can only pin your own chirps")
+	case errors.Is(err, ErrTooManyPins):
+		RespondWithError(w, http.StatusConflict, fmt.Sprintf("You can pin at most %d chirps", maxPinnedChirps))
+	case err != nil:
+		log.Printf("Failed to pin chirp: %v", err)
+		RespondWithError(w, http.StatusInternalServerError, "Failed to pin chirp")
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (ch *chirpHandler) unpinChirpHandler(w http.ResponseWriter, r *http.Request) {
+	userId := currentUserId(r)
+
+	id, err := strconv.Atoi(r.PathValue("CHIRPID"))
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid chirp ID")
+		return
+	}
+
+	err = ch.db.UnpinChirp(userId, id)
+	if errors.Is(err, ErrNotFound) {
+		RespondWithError(w, http.StatusNotFound, "Chirp is not pinned")
+		return
+	}
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to unpin chirp")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (ch *chirpHandler) getUserChirpsHandler(w http.ResponseWriter, r *http.Request) {
+	viewer, err := ch.viewerFor(r)
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to load chirps")
+		return
+	}
+	page, err := parsePage(r)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	authorId, err := strconv.Atoi(r.PathValue("USERID"))
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	chirps, err := ch.db.GetChirpsByAuthor(authorId)
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to load chirps")
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, paginate(viewer.filter(chirps), page))
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	. "github.com/mohamed2394/goserver/internal"
+	. "github.com/mohamed2394/goserver/internal/database"
+)
+
+// maxMessageLength is the longest direct message body, in bytes
+const maxMessageLength = 1000
+
+type conversationHandler struct {
+	db     *DB
+	apiCfg *apiConfig
+}
+
+func (cvh *conversationHandler) createConversationHandler(w http.ResponseWriter, r *http.Request) {
+	userId := currentUserId(r)
+
+	var reqBody ConversationRequest
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	conversation, created, err := cvh.db.GetOrCreateConversation(userId, reqBody.RecipientId)
+	switch {
+	case errors.Is(err, ErrSelfConversation):
+		RespondWithError(w, http.StatusBadRequest, "You can't message yourself")
+	case errors.Is(err, ErrNotFound):
+		RespondWithError(w, http.StatusNotFound, "User not found")
+	case errors.Is(err, ErrBlocked):
+		RespondWithError(w, http.StatusForbidden, "You can't message this user")
+	case err != nil:
+		log.Printf("Failed to start conversation: %v", err)
+		RespondWithError(w, http.StatusInternalServerError, "Failed to start conversation")
+	case created:
+		RespondWithJSON(w, http.StatusCreated, conversation)
+	default:
+		RespondWithJSON(w, http.StatusOK, conversation)
+	}
+}
+
+func (cvh *conversationHandler) getConversationsHandler(w http.ResponseWriter, r *http.Request) {
+	userId := currentUserId(r)
+	page, err := parsePage(r)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	conversations, err := cvh.db.GetConversations(userId)
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to load conversations")
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, paginate(conversations, page))
+}
+
+func (cvh *conversationHandler) getConversationHandler(w http.ResponseWriter, r *http.Request) {
+	userId := currentUserId(r)
+	id, err := strconv.Atoi(r.PathValue("CONVERSATIONID"))
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid conversation ID")
+		return
+	}
+
+	conversation, err := cvh.db.GetConversation(id, userId)
+	if errors.Is(err, ErrNotFound) {
+		RespondWithError(w, http.StatusNotFound, "Conversation not found")
+		return
+	}
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to load conversation")
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, conversation)
+}
+
+func (cvh *conversationHandler) getMessagesHandler(w http.ResponseWriter, r *http.Request) {
+	userId := currentUserId(r)
+	id, err := strconv.Atoi(r.PathValue("CONVERSATIONID"))
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid conversation ID")
+		return
+	}
+	page, err := parseChirpPage(r)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	messages, err := cvh.db.GetMessages(id, userId)
+	if errors.Is(err, ErrNotFound) {
+		RespondWithError(w, http.StatusNotFound, "Conversation not found")
+		return
+	}
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to load messages")
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, pageNewestFirst(messages, page, func(m Message) int { return m.Id }))
+}
+
+func (cvh *conversationHandler) postMessageHandler(w http.ResponseWriter, r *http.Request) {
+	userId := currentUserId(r)
+	id, err := strconv.Atoi(r.PathValue("CONVERSATIONID"))
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid conversation ID")
+		return
+	}
+
+	var reqBody MessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+	if reqBody.Body == "" {
+		RespondWithError(w, http.StatusBadRequest, "Message is empty")
+		return
+	}
+	if len(reqBody.Body) > maxMessageLength {
+		RespondWithError(w, http.StatusBadRequest, "Message is too long")
+		return
+	}
+
+	message, err := cvh.db.CreateMessage(id, userId, replaceProfaneWords(reqBody.Body, profaneWords))
+	switch {
+	case errors.Is(err, ErrNotFound):
+		RespondWithError(w, http.StatusNotFound, "Conversation not found")
+	case errors.Is(err, ErrBlocked):
+		RespondWithError(w, http.StatusForbidden, "You can't message this user")
+	case err != nil:
+		log.Printf("Failed to send message: %v", err)
+		RespondWithError(w, http.StatusInternalServerError, "Failed to send message")
+	default:
+		RespondWithJSON(w, http.StatusCreated, message)
+	}
+}
+
+func (cvh *conversationHandler) markReadHandler(w http.ResponseWriter, r *http.Request) {
+	userId := currentUserId(r)
+	id, err := strconv.Atoi(r.PathValue("CONVERSATIONID"))
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid conversation ID")
+		return
+	}
+
+	// An empty body marks everything read
+	var reqBody ReadReceiptRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+			RespondWithError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+	}
+
+	err = cvh.db.MarkConversationRead(id, userId, reqBody.MessageId)
+	if errors.Is(err, ErrNotFound) {
+		RespondWithError(w, http.StatusNotFound, "Message not found")
+		return
+	}
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to mark conversation read")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
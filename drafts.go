@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	. "github.com/mohamed2394/goserver/internal"
+	. "github.com/mohamed2394/goserver/internal/database"
+)
+
+func (ch *chirpHandler) createDraftHandler(w http.ResponseWriter, r *http.Request) {
+	userId := currentUserId(r)
+
+	var reqBody DraftRequest
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	visibility, err := parseVisibility(reqBody.Visibility)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	draft, err := ch.db.CreateDraft(userId, reqBody.Body, visibility)
+	if err != nil {
+		log.Printf("Failed to save draft: %v", err)
+		RespondWithError(w, http.StatusInternalServerError, "Failed to save draft")
+		return
+	}
+
+	RespondWithJSON(w, http.StatusCreated, draft)
+}
+
+func (ch *chirpHandler) getDraftsHandler(w http.ResponseWriter, r *http.Request) {
+	userId := currentUserId(r)
+
+	drafts, err := ch.db.GetDrafts(userId)
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to load drafts")
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, drafts)
+}
+
+func (ch *chirpHandler) updateDraftHandler(w http.ResponseWriter, r *http.Request) {
+	userId := currentUserId(r)
+
+	id, err := strconv.Atoi(r.PathValue("DRAFTID"))
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid draft ID")
+		return
+	}
+
+	var reqBody DraftRequest
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	visibility, err := parseVisibility(reqBody.Visibility)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	draft, err := ch.db.UpdateDraft(id, userId, reqBody.Body, visibility)
+	if errors.Is(err, ErrNotFound) {
+		RespondWithError(w, http.StatusNotFound, "Draft not found")
+		return
+	}
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to update draft")
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, draft)
+}
+
+func (ch *chirpHandler) deleteDraftHandler(w http.ResponseWriter, r *http.Request) {
+	userId := currentUserId(r)
+
+	id, err := strconv.Atoi(r.PathValue("DRAFTID"))
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid draft ID")
+		return
+	}
+
+	err = ch.db.DeleteDraft(id, userId)
+	if errors.Is(err, ErrNotFound) {
+		RespondWithError(w, http.StatusNotFound, "Draft not found")
+		return
+	}
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to delete draft")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (ch *chirpHandler) publishDraftHandler(w http.ResponseWriter, r *http.Request) {
+	userId := currentUserId(r)
+	if !ch.canPost(w, userId) {
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("DRAFTID"))
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid draft ID")
+		return
+	}
+
+	// Validation runs inside the same write as the publish so the draft
+	// can't change between being checked and becoming a chirp
+	chirp, err := ch.db.PublishDraft(id, userId, validateChirpBody)
+	if errors.Is(err, ErrNotFound) {
+		RespondWithError(w, http.StatusNotFound, "Draft not found")
+		return
+	}
+	if errors.Is(err, errChirpTooLong) {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to publish draft: %v", err)
+		RespondWithError(w, http.StatusInternalServerError, "Failed to publish draft")
+		return
+	}
+
+	log.Printf("Chirp created with ID: %d", chirp.Id)
+	ch.events.Publish(chirpEvent{Type: chirpCreated, Chirp: chirp})
+	RespondWithJSON(w, http.StatusCreated, chirp)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	. "github.com/mohamed2394/goserver/internal"
+	. "github.com/mohamed2394/goserver/internal/database"
+	"github.com/mohamed2394/goserver/internal/mail"
+)
+
+// emailVerificationTTL is how long an email verification link works
+const emailVerificationTTL = 48 * time.Hour
+
+// startEmailVerification emails userId a link to verify their current
+// address. Delivery happens in the background.
+func (uh *userHandler) startEmailVerification(userId int) error {
+	token, err := newOpaqueToken()
+	if err != nil {
+		return err
+	}
+	user, err := uh.db.CreateEmailVerification(userId, token, time.Now(), emailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		link := fmt.Sprintf("%s/app/verify-email?token=%s", uh.publicURL, url.QueryEscape(token))
+		err := uh.mailer.Send(mail.Message{
+			To:      user.Email,
+			Subject: "Verify your Chirpy email address",
+			Body: fmt.Sprintf("Welcome to Chirpy!\n\n"+
+				"To confirm that this is your email address, open %s\n"+
+				"or use this verification token: %s\n\n"+
+				"The link expires in %d hours.\n",
+				link, token, int(emailVerificationTTL.Hours())),
+		})
+		if err != nil {
+			log.Printf("Failed to send email verification to user %d: %v", user.Id, err)
+		}
+	}()
+	return nil
+}
+
+func (uh *userHandler) verifyEmailHandler(w http.ResponseWriter, r *http.Request) {
+	var reqBody VerifyEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+	if reqBody.Token == "" {
+		RespondWithError(w, http.StatusBadRequest, "Token is required")
+		return
+	}
+
+	user, err := uh.db.VerifyEmail(reqBody.Token, time.Now())
+	if errors.Is(err, ErrNotFound) {
+		RespondWithError(w, http.StatusBadRequest, "Invalid or expired verification token")
+		return
+	}
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to verify email")
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"id":       user.Id,
+		"email":    user.Email,
+		"verified": user.Verified,
+	})
+}
+
+// resendVerificationHandler sends a new verification link, replacing any
+// earlier one
+func (uh *userHandler) resendVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	userId := currentUserId(r)
+
+	user, err := uh.db.GetUserById(userId)
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to load user")
+		return
+	}
+	if user.Verified {
+		RespondWithError(w, http.StatusConflict, "Email is already verified")
+		return
+	}
+
+	if err := uh.startEmailVerification(userId); err != nil {
+		log.Printf("Failed to start email verification: %v", err)
+		RespondWithError(w, http.StatusInternalServerError, "Failed to send verification email")
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// canPost reports whether userId may post chirps, responding with an error
+// if not. With the verified email policy on, only verified users may post,
+// apart from accounts that predate email verification.
+func (ch *chirpHandler) canPost(w http.ResponseWriter, userId int) bool {
+	if !ch.apiCfg.requireVerifiedEmail {
+		return true
+	}
+
+	user, err := ch.db.GetUserById(userId)
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to load user")
+		return false
+	}
+	if !user.Verified && !user.PredatesVerification {
+		RespondWithError(w, http.StatusForbidden, "Verify your email address before posting")
+		return false
+	}
+	return true
+}
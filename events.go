@@ -0,0 +1,43 @@
+package main
+
+import (
+	"sync"
+
+	. "github.com/mohamed2394/goserver/internal"
+)
+
+type chirpEventType string
+
+const (
+	chirpCreated chirpEventType = "chirp.created"
+	chirpDeleted chirpEventType = "chirp.deleted"
+)
+
+// chirpEvent tells subscribers that something happened to a chirp
+type chirpEvent struct {
+	Type  chirpEventType
+	Chirp Chirp
+}
+
+// chirpEvents fans chirp events out to in-process subscribers, such as caches
+// and indexes that have to forget deleted chirps
+type chirpEvents struct {
+	mu          sync.RWMutex
+	subscribers []func(chirpEvent)
+}
+
+// Subscribe registers fn to be called for every published event
+func (e *chirpEvents) Subscribe(fn func(chirpEvent)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.subscribers = append(e.subscribers, fn)
+}
+
+// Publish calls every subscriber synchronously, in subscription order
+func (e *chirpEvents) Publish(event chirpEvent) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	for _, fn := range e.subscribers {
+		fn(event)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	. "github.com/mohamed2394/goserver/internal"
+	. "github.com/mohamed2394/goserver/internal/database"
+)
+
+func (uh *userHandler) followUserHandler(w http.ResponseWriter, r *http.Request) {
+	userId := currentUserId(r)
+
+	followeeId, err := strconv.Atoi(r.PathValue("USERID"))
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	created, err := uh.db.Follow(userId, followeeId)
+	if created {
+		uh.notifier.notifyFollow(userId, followeeId)
+	}
+	switch {
+	case errors.Is(err, ErrSelfFollow):
+		RespondWithError(w, http.StatusBadRequest, "You can't follow yourself")
+	case errors.Is(err, ErrNotFound):
+		RespondWithError(w, http.StatusNotFound, "User not found")
+	case errors.Is(err, ErrBlocked):
+		RespondWithError(w, http.StatusForbidden, "You can't follow this user")
+	case err != nil:
+		log.Printf("Failed to follow user: %v", err)
+		RespondWithError(w, http.StatusInternalServerError, "Failed to follow user")
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (uh *userHandler) unfollowUserHandler(w http.ResponseWriter, r *http.Request) {
+	userId := currentUserId(r)
+
+	followeeId, err := strconv.Atoi(r.PathValue("USERID"))
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	err = uh.db.Unfollow(userId, followeeId)
+	if errors.Is(err, ErrNotFound) {
+		RespondWithError(w, http.StatusNotFound, "You don't follow this user")
+		return
+	}
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to unfollow user")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (uh *userHandler) getFollowersHandler(w http.ResponseWriter, r *http.Request) {
+	uh.respondWithFollows(w, r, uh.db.GetFollowers)
+}
+
+func (uh *userHandler) getFollowingHandler(w http.ResponseWriter, r *http.Request) {
+	uh.respondWithFollows(w, r, uh.db.GetFollowing)
+}
+
+// respondWithFollows writes one page of the follow edges load returns for the user in the path
+func (uh *userHandler) respondWithFollows(w http.ResponseWriter, r *http.Request, load func(userId int) ([]Follow, error)) {
+	userId, err := strconv.Atoi(r.PathValue("USERID"))
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	page, err := parsePage(r)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	follows, err := load(userId)
+	if errors.Is(err, ErrNotFound) {
+		RespondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to load follows")
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, paginate(follows, page))
+}
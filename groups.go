@@ -0,0 +1,281 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	. "github.com/mohamed2394/goserver/internal"
+	. "github.com/mohamed2394/goserver/internal/database"
+)
+
+const (
+	maxGroupNameLength        = 50
+	maxGroupDescriptionLength = 500
+)
+
+type groupHandler struct {
+	db     *DB
+	apiCfg *apiConfig
+}
+
+// respondToGroupPostError writes the response for a chirp refused because of
+// its group and reports whether it did
+func respondToGroupPostError(w http.ResponseWriter, err error) bool {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		RespondWithError(w, http.StatusNotFound, "Group not found")
+	case errors.Is(err, ErrNotGroupMember):
+		RespondWithError(w, http.StatusForbidden, "You must join the group to post in it")
+	default:
+		return false
+	}
+	return true
+}
+
+// canModerate reports whether userId is an owner or moderator of groupId
+func (ch *chirpHandler) canModerate(groupId, userId int) bool {
+	if groupId == 0 {
+		return false
+	}
+	member, err := ch.db.GetGroupMember(groupId, userId)
+	return err == nil && member.CanModerate()
+}
+
+func (gh *groupHandler) createGroupHandler(w http.ResponseWriter, r *http.Request) {
+	userId := currentUserId(r)
+
+	var reqBody GroupRequest
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+	reqBody.Name = strings.TrimSpace(reqBody.Name)
+	if reqBody.Name == "" {
+		RespondWithError(w, http.StatusBadRequest, "Group name is required")
+		return
+	}
+	if len(reqBody.Name) > maxGroupNameLength {
+		RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Group name must be at most %d characters", maxGroupNameLength))
+		return
+	}
+	if len(reqBody.Description) > maxGroupDescriptionLength {
+		RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Group description must be at most %d characters", maxGroupDescriptionLength))
+		return
+	}
+
+	group, err := gh.db.CreateGroup(userId, reqBody.Name, reqBody.Description)
+	if err != nil {
+		log.Printf("Failed to create group: %v", err)
+		RespondWithError(w, http.StatusInternalServerError, "Failed to create group")
+		return
+	}
+
+	RespondWithJSON(w, http.StatusCreated, group)
+}
+
+func (gh *groupHandler) getGroupsHandler(w http.ResponseWriter, r *http.Request) {
+	page, err := parsePage(r)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	groups, err := gh.db.GetGroups()
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to load groups")
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, paginate(groups, page))
+}
+
+func (gh *groupHandler) getGroupHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("GROUPID"))
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid group ID")
+		return
+	}
+
+	group, err := gh.db.GetGroup(id)
+	if errors.Is(err, ErrNotFound) {
+		RespondWithError(w, http.StatusNotFound, "Group not found")
+		return
+	}
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to load group")
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, group)
+}
+
+func (gh *groupHandler) joinGroupHandler(w http.ResponseWriter, r *http.Request) {
+	userId := currentUserId(r)
+	id, err := strconv.Atoi(r.PathValue("GROUPID"))
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid group ID")
+		return
+	}
+
+	member, err := gh.db.JoinGroup(id, userId)
+	if errors.Is(err, ErrNotFound) {
+		RespondWithError(w, http.StatusNotFound, "Group not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to join group: %v", err)
+		RespondWithError(w, http.StatusInternalServerError, "Failed to join group")
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, member)
+}
+
+func (gh *groupHandler) getGroupMembersHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("GROUPID"))
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid group ID")
+		return
+	}
+	page, err := parsePage(r)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	members, err := gh.db.GetGroupMembers(id)
+	if errors.Is(err, ErrNotFound) {
+		RespondWithError(w, http.StatusNotFound, "Group not found")
+		return
+	}
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to load group members")
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, paginate(members, page))
+}
+
+// removeGroupMemberHandler lets a member leave a group, or a moderator remove someone
+func (gh *groupHandler) removeGroupMemberHandler(w http.ResponseWriter, r *http.Request) {
+	userId := currentUserId(r)
+	id, err := strconv.Atoi(r.PathValue("GROUPID"))
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid group ID")
+		return
+	}
+	memberId, err := strconv.Atoi(r.PathValue("USERID"))
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	err = gh.db.RemoveGroupMember(id, userId, memberId)
+	if gh.respondToMembershipError(w, err) {
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to remove group member: %v", err)
+		RespondWithError(w, http.StatusInternalServerError, "Failed to remove group member")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (gh *groupHandler) setGroupRoleHandler(w http.ResponseWriter, r *http.Request) {
+	userId := currentUserId(r)
+	id, err := strconv.Atoi(r.PathValue("GROUPID"))
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid group ID")
+		return
+	}
+	memberId, err := strconv.Atoi(r.PathValue("USERID"))
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	var reqBody GroupRoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+	if reqBody.Role != GroupRoleModerator && reqBody.Role != GroupRoleMember {
+		RespondWithError(w, http.StatusBadRequest, "role must be moderator or member")
+		return
+	}
+
+	member, err := gh.db.SetGroupRole(id, userId, memberId, reqBody.Role)
+	if gh.respondToMembershipError(w, err) {
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to change group role: %v", err)
+		RespondWithError(w, http.StatusInternalServerError, "Failed to change group role")
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, member)
+}
+
+// respondToMembershipError writes the response for the expected errors of a
+// membership change and reports whether it did
+func (gh *groupHandler) respondToMembershipError(w http.ResponseWriter, err error) bool {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		RespondWithError(w, http.StatusNotFound, "Group not found")
+	case errors.Is(err, ErrNotGroupMember):
+		RespondWithError(w, http.StatusNotFound, "User is not a member of this group")
+	case errors.Is(err, ErrGroupOwner):
+		RespondWithError(w, http.StatusBadRequest, "The group owner can't leave or be changed")
+	case errors.Is(err, ErrNotPermitted):
+		RespondWithError(w, http.StatusForbidden, "You are not allowed to do this in this group")
+	default:
+		return false
+	}
+	return true
+}
+
+// getGroupChirpsHandler returns the chirps posted into a group, newest first
+// with limit/cursor pagination. Only members can read them.
+func (gh *groupHandler) getGroupChirpsHandler(w http.ResponseWriter, r *http.Request) {
+	userId := currentUserId(r)
+	id, err := strconv.Atoi(r.PathValue("GROUPID"))
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid group ID")
+		return
+	}
+	page, err := parseChirpPage(r)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	chirps, err := gh.db.GetGroupChirps(id)
+	if errors.Is(err, ErrNotFound) {
+		RespondWithError(w, http.StatusNotFound, "Group not found")
+		return
+	}
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to load group chirps")
+		return
+	}
+
+	viewer, err := newChirpViewer(gh.db, userId)
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to load group chirps")
+		return
+	}
+	if !viewer.relations.Groups[id] {
+		RespondWithError(w, http.StatusForbidden, "Only group members can read its chirps")
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, page.applyNewestFirst(viewer.filterFeed(chirps)))
+}
@@ -1,50 +1,122 @@
 package main
 
 import (
-	"crypto/rand"
-	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
-	"github.com/golang-jwt/jwt"
 	. "github.com/mohamed2394/goserver/internal"
+	"github.com/mohamed2394/goserver/internal/auth"
 	. "github.com/mohamed2394/goserver/internal/database"
+	"github.com/mohamed2394/goserver/internal/mail"
 )
 
 type apiConfig struct {
 	mu             sync.Mutex
 	fileserverHits int
-	secretKey      string
+	issuer         *auth.Issuer
+	verifier       *auth.Verifier
+	revocations    *tokenRevocations
+	ttls           tokenLifetimes
+	// requireVerifiedEmail blocks users from posting chirps until they
+	// have verified their email. Accounts created before emails were
+	// verified are exempt.
+	requireVerifiedEmail bool
 }
 
+// tokenLifetimes configures how long issued tokens stay valid
+type tokenLifetimes struct {
+	// Access is the lifetime of an access token the client asked no
+	// particular lifetime for
+	Access time.Duration
+	// MaxAccess caps the access token lifetime a client may ask for
+	MaxAccess time.Duration
+	// Refresh is how long a session lasts without logging in again
+	Refresh time.Duration
+}
+
+// accessTTL returns the lifetime of an access token for which the client
+// asked for requestedSeconds, clamped to MaxAccess. Zero or less asks for
+// the default.
+func (tl tokenLifetimes) accessTTL(requestedSeconds int) time.Duration {
+	if requestedSeconds <= 0 {
+		return tl.Access
+	}
+	return min(time.Duration(requestedSeconds)*time.Second, tl.MaxAccess)
+}
+
+const maxChirpLength = 140
+
+// maxExpiresIn is the longest lifetime of an ephemeral chirp, in seconds
+const maxExpiresIn = 30 * 24 * 60 * 60
+
+var profaneWords = []string{"kerfuffle", "sharbert", "fornax"}
+
+var errChirpTooLong = errors.New("Chirp is too long")
+
 type readinessHandler struct{}
 type userHandler struct {
-	db     *DB
-	apiCfg *apiConfig
+	db       *DB
+	apiCfg   *apiConfig
+	notifier *notifier
+	mailer   mail.Mailer
+	// publicURL is where users reach the server, for links in emails
+	publicURL string
 }
 
 type chirpHandler struct {
-	db     *DB
-	apiCfg *apiConfig
+	db        *DB
+	apiCfg    *apiConfig
+	scheduler *chirpScheduler
+	events    *chirpEvents
 }
 
+// getChirpsHandler returns all the chirps the viewer may read, oldest first.
+// With ?limit= or ?cursor= it instead returns one page, newest first, like
+// the timelines.
 func (ch *chirpHandler) getChirpsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	paged := query.Has("limit") || query.Has("cursor")
+	page, err := parseChirpPage(r)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	viewer, err := ch.viewerFor(r)
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to load chirps")
+		return
+	}
+
 	chirps, err := ch.db.GetChirps()
 	if err != nil {
 		RespondWithError(w, http.StatusBadRequest, "Something went wrong")
 		return
 	}
+	chirps = viewer.filterFeed(chirps)
 
+	if paged {
+		// GetChirps sorts oldest first
+		slices.Reverse(chirps)
+		chirps = page.applyNewestFirst(chirps)
+	}
 	RespondWithJSON(w, http.StatusOK, chirps)
 }
 
 func (ch *chirpHandler) getChirpByIdHandler(w http.ResponseWriter, r *http.Request) {
+	viewer, err := ch.viewerFor(r)
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to load chirps")
+		return
+	}
+
 	// Extract the chirp ID from the URL
 	stringId := r.PathValue("CHIRPID")
 	id, err := strconv.Atoi(stringId)
@@ -53,25 +125,22 @@ func (ch *chirpHandler) getChirpByIdHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	// Convert to zero-based index
-	zeroBasedID := id - 1
-
-	// Fetch all chirps from the database
-	chirps, err := ch.db.GetChirps()
+	chirp, err := ch.db.GetChirp(id)
+	if errors.Is(err, ErrNotFound) {
+		RespondWithError(w, http.StatusNotFound, "Chirp not found")
+		return
+	}
 	if err != nil {
 		RespondWithError(w, http.StatusInternalServerError, "Failed to load chirps from the database")
 		return
 	}
 
-	// Ensure the zero-based chirp ID is within the valid range
-	if zeroBasedID < 0 || zeroBasedID >= len(chirps) {
+	// Chirps the viewer may not read are reported as missing so their existence doesn't leak
+	if !viewer.canSee(chirp) {
 		RespondWithError(w, http.StatusNotFound, "Chirp not found")
 		return
 	}
 
-	// Fetch the chirp
-	chirp := chirps[zeroBasedID]
-
 	// Respond with the chirp in JSON format
 	RespondWithJSON(w, http.StatusOK, chirp)
 }
@@ -80,7 +149,6 @@ func (ch *chirpHandler) postChirpsHandler(w http.ResponseWriter, r *http.Request
 	log.Println("Received a POST request on /api/chirps")
 
 	var reqBody ChirpRequest
-	profaneWords := []string{"kerfuffle", "sharbert", "fornax"}
 
 	err := json.NewDecoder(r.Body).Decode(&reqBody)
 	if err != nil {
@@ -88,86 +156,87 @@ func (ch *chirpHandler) postChirpsHandler(w http.ResponseWriter, r *http.Request
 		RespondWithError(w, http.StatusBadRequest, "Invalid JSON")
 		return
 	}
-	authHeader := r.Header.Get("Authorization")
-	if !strings.HasPrefix(authHeader, "Bearer ") {
-		RespondWithError(w, http.StatusUnauthorized, "Authorization header missing or malformed")
+	userId := currentUserId(r)
+	if !ch.canPost(w, userId) {
 		return
 	}
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 
-	// Parse the token
-	token, err := jwt.ParseWithClaims(tokenString, &jwt.MapClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(ch.apiCfg.secretKey), nil
-	})
-	if err != nil || !token.Valid {
-		RespondWithError(w, http.StatusUnauthorized, "Invalid or expired token")
-		return
-	}
-
-	// Extract claims
-	claims, ok := token.Claims.(*jwt.MapClaims)
-	if !ok {
-		RespondWithError(w, http.StatusUnauthorized, "Invalid token claims")
+	cleanedBody, err := validateChirpBody(reqBody.Body)
+	if err != nil {
+		log.Println(err)
+		RespondWithError(w, http.StatusBadRequest, err.Error())
 		return
 	}
-	userId, err := strconv.Atoi((*claims)["sub"].(string))
+	visibility, err := parseVisibility(reqBody.Visibility)
 	if err != nil {
-		RespondWithError(w, http.StatusUnauthorized, "Invalid user ID in token")
+		RespondWithError(w, http.StatusBadRequest, err.Error())
 		return
 	}
+	newChirp := Chirp{
+		Body:       cleanedBody,
+		AuthorId:   userId,
+		Visibility: visibility,
+		GroupId:    reqBody.GroupId,
+	}
+	opensAt := time.Now()
+	if reqBody.PublishAt != nil {
+		opensAt = *reqBody.PublishAt
+	}
+	if reqBody.ExpiresIn != 0 {
+		if reqBody.ExpiresIn < 0 || reqBody.ExpiresIn > maxExpiresIn {
+			RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("expires_in must be between 1 and %d seconds", maxExpiresIn))
+			return
+		}
+		expiresAt := opensAt.Add(time.Duration(reqBody.ExpiresIn) * time.Second).UTC()
+		newChirp.ExpiresAt = &expiresAt
+	}
+	if reqBody.Poll != nil {
+		newChirp.Poll, err = newPoll(reqBody.Poll, opensAt)
+		if err != nil {
+			RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
 
-	if len(reqBody.Body) > 140 {
-		log.Println("Chirp is too long")
-		RespondWithError(w, http.StatusBadRequest, "Chirp is too long")
+	if reqBody.PublishAt != nil {
+		if !reqBody.PublishAt.After(time.Now()) {
+			RespondWithError(w, http.StatusBadRequest, "publish_at must be in the future")
+			return
+		}
+		scheduled, err := ch.db.CreateScheduledChirp(newChirp, *reqBody.PublishAt)
+		if respondToGroupPostError(w, err) {
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to schedule chirp: %v", err)
+			RespondWithError(w, http.StatusInternalServerError, "Failed to schedule chirp")
+			return
+		}
+		ch.scheduler.Schedule(scheduled)
+		log.Printf("Chirp scheduled with ID: %d", scheduled.Id)
+		RespondWithJSON(w, http.StatusCreated, scheduled)
 		return
 	}
 
-	cleanedBody := replaceProfaneWords(reqBody.Body, profaneWords)
-	log.Printf("Cleaned chirp body: %s", cleanedBody)
-
-	chirp, err := ch.db.CreateChirp(cleanedBody)
+	chirp, err := ch.db.CreateChirp(newChirp)
+	if respondToGroupPostError(w, err) {
+		return
+	}
 	if err != nil {
 		log.Printf("Failed to save chirp: %v", err)
 		RespondWithError(w, http.StatusInternalServerError, "Failed to save chirp")
 		return
 	}
 
-	chirp.AuthorId = userId
 	log.Printf("Chirp created with ID: %d", chirp.Id)
+	ch.events.Publish(chirpEvent{Type: chirpCreated, Chirp: chirp})
 	RespondWithJSON(w, http.StatusCreated, chirp)
 }
 
 func (ch *chirpHandler) deleteChirpHandler(w http.ResponseWriter, r *http.Request) {
 	log.Println("Received a delete request on /api/chirps/{chirpID}")
 
-	// Extract the JWT from the Authorization header
-	authHeader := r.Header.Get("Authorization")
-	if !strings.HasPrefix(authHeader, "Bearer ") {
-		RespondWithError(w, http.StatusUnauthorized, "Authorization header missing or malformed")
-		return
-	}
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-
-	// Parse the token
-	token, err := jwt.ParseWithClaims(tokenString, &jwt.MapClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(ch.apiCfg.secretKey), nil
-	})
-	if err != nil || !token.Valid {
-		RespondWithError(w, http.StatusUnauthorized, "Invalid or expired token")
-		return
-	}
-
-	// Extract claims
-	claims, ok := token.Claims.(*jwt.MapClaims)
-	if !ok {
-		RespondWithError(w, http.StatusUnauthorized, "Invalid token claims")
-		return
-	}
-	userId, err := strconv.Atoi((*claims)["sub"].(string))
-	if err != nil {
-		RespondWithError(w, http.StatusUnauthorized, "Invalid user ID in token")
-		return
-	}
+	userId := currentUserId(r)
 
 	// Extract chirpID from URL
 	chirpID := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
@@ -184,8 +253,9 @@ func (ch *chirpHandler) deleteChirpHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	// Authorization check: Ensure the user is the author of the chirp
-	if chirp.AuthorId != userId {
+	// Authorization check: Ensure the user is the author of the chirp or
+	// moderates the group it was posted into
+	if chirp.AuthorId != userId && !ch.canModerate(chirp.GroupId, userId) {
 		RespondWithError(w, http.StatusForbidden, "You are not authorized to delete this chirp")
 		return
 	}
@@ -196,11 +266,58 @@ func (ch *chirpHandler) deleteChirpHandler(w http.ResponseWriter, r *http.Reques
 		RespondWithError(w, http.StatusInternalServerError, "Failed to delete chirp")
 		return
 	}
+	ch.events.Publish(chirpEvent{Type: chirpDeleted, Chirp: chirp})
 
 	// Respond with 204 No Content
 	w.WriteHeader(http.StatusNoContent)
 }
 
+func (ch *chirpHandler) getScheduledChirpsHandler(w http.ResponseWriter, r *http.Request) {
+	userId := currentUserId(r)
+
+	scheduled, err := ch.db.GetScheduledChirps(userId)
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to load scheduled chirps")
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, scheduled)
+}
+
+func (ch *chirpHandler) cancelScheduledChirpHandler(w http.ResponseWriter, r *http.Request) {
+	userId := currentUserId(r)
+
+	id, err := strconv.Atoi(r.PathValue("CHIRPID"))
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid chirp ID")
+		return
+	}
+
+	// Other authors' scheduled chirps are reported as missing rather than forbidden
+	err = ch.db.DeleteScheduledChirp(id, userId)
+	if errors.Is(err, ErrNotFound) {
+		RespondWithError(w, http.StatusNotFound, "Scheduled chirp not found")
+		return
+	}
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to cancel scheduled chirp")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// validateChirpBody checks a chirp body and returns it with profanity masked
+func validateChirpBody(body string) (string, error) {
+	if len(body) > maxChirpLength {
+		return "", errChirpTooLong
+	}
+
+	cleanedBody := replaceProfaneWords(body, profaneWords)
+	log.Printf("Cleaned chirp body: %s", cleanedBody)
+	return cleanedBody, nil
+}
+
 // Function to replace profane words
 func replaceProfaneWords(text string, profaneWords []string) string {
 	words := strings.Fields(text) // Split the text into words
@@ -265,11 +382,27 @@ func (uh *userHandler) createUserHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	reqBody.Email, err = NormalizeEmail(reqBody.Email)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := validatePassword(reqBody.Password); err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if reqBody.Handle != "" && !validHandle(reqBody.Handle) {
+		RespondWithError(w, http.StatusBadRequest, errInvalidHandle.Error())
+		return
+	}
+
 	// Create user
-	user, err := uh.db.CreateUser(reqBody.Email, reqBody.Password)
+	user, err := uh.db.CreateUser(reqBody.Email, reqBody.Password, reqBody.Handle)
 	if err != nil {
-		if err.Error() == "email already in use" {
+		if errors.Is(err, ErrEmailInUse) {
 			RespondWithError(w, http.StatusConflict, "Email already in use")
+		} else if errors.Is(err, ErrHandleTaken) {
+			RespondWithError(w, http.StatusConflict, "Handle is already taken")
 		} else {
 			log.Printf("Failed to create user: %v", err)
 			RespondWithError(w, http.StatusInternalServerError, "Failed to create user")
@@ -279,13 +412,21 @@ func (uh *userHandler) createUserHandler(w http.ResponseWriter, r *http.Request)
 
 	log.Printf("User created with ID: %d", user.Id)
 
+	if err := uh.startEmailVerification(user.Id); err != nil {
+		log.Printf("Failed to start email verification: %v", err)
+	}
+
 	// Respond with user info, excluding password
 	response := struct {
-		Id    int    `json:"id"`
-		Email string `json:"email"`
+		Id       int    `json:"id"`
+		Email    string `json:"email"`
+		Handle   string `json:"handle"`
+		Verified bool   `json:"verified"`
 	}{
-		Id:    user.Id,
-		Email: user.Email,
+		Id:       user.Id,
+		Email:    user.Email,
+		Handle:   user.Handle,
+		Verified: user.Verified,
 	}
 	RespondWithJSON(w, http.StatusCreated, response)
 }
@@ -299,42 +440,57 @@ func (uh *userHandler) loginUserHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	user, errU := uh.db.GetUser(reqBody.Email, reqBody.Password)
+	email, err := NormalizeEmail(reqBody.Email)
+	if err != nil {
+		RespondWithError(w, http.StatusUnauthorized, "Invalid email or password")
+		return
+	}
+	user, errU := uh.db.GetUser(email, reqBody.Password)
 	if errU != nil {
 		RespondWithError(w, http.StatusUnauthorized, "Invalid email or password")
 		return
 	}
-	claims := &jwt.MapClaims{
-		"iss": "chirpy",
-		"iat": time.Now().UTC().Unix(),
-		"exp": time.Now().UTC().Add(time.Hour).Unix(),
-		"sub": strconv.Itoa(user.Id),
+
+	// With two-factor authentication on, tokens are only issued once the
+	// second factor is proven at POST /api/login/2fa
+	tf, err := uh.db.GetTwoFactor(user.Id)
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to load two-factor settings")
+		return
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(uh.apiCfg.secretKey))
+	if tf.Enabled() {
+		uh.startMFAChallenge(w, user.Id, reqBody)
+		return
+	}
+
+	uh.completeLogin(w, r, user, reqBody.DeviceLabel, reqBody.ExpiresInSeconds)
+}
+
+// completeLogin starts a session for user and responds with its tokens
+func (uh *userHandler) completeLogin(w http.ResponseWriter, r *http.Request, user User, deviceLabel string, expiresInSeconds int) {
+	tokenString, claims, err := uh.apiCfg.issueAccessToken(user.Id, uh.apiCfg.ttls.accessTTL(expiresInSeconds))
 	if err != nil {
 		RespondWithError(w, http.StatusInternalServerError, "Error generating token")
 		return
 	}
 
-	refresh := make([]byte, 32)
-	_, errR := rand.Read(refresh)
-
-	if errR != nil {
+	refreshToken, session, err := uh.startSession(r, user.Id, deviceLabel, expiresInSeconds)
+	if err != nil {
+		log.Printf("Failed to start session: %v", err)
 		RespondWithError(w, http.StatusInternalServerError, "Error generating refresh token")
 		return
-
 	}
-	refreshToken := hex.EncodeToString(refresh)
 
-	uh.db.UpdateUser(user.Id, user.Email, user.Password, refreshToken)
 	RespondWithJSON(w, http.StatusOK, map[string]interface{}{
-		"id":            user.Id,
-		"email":         user.Email,
-		"token":         tokenString,
-		"refresh_token": refreshToken,
+		"id":                       user.Id,
+		"email":                    user.Email,
+		"verified":                 user.Verified,
+		"token":                    tokenString,
+		"expires_at":               claims.ExpiresAt,
+		"expires_in_seconds":       int(claims.ExpiresAt.Sub(claims.IssuedAt).Seconds()),
+		"refresh_token":            refreshToken,
+		"refresh_token_expires_at": session.ExpiresAt,
 	})
-
 }
 
 func (uh *userHandler) updateUserHandler(w http.ResponseWriter, r *http.Request) {
@@ -345,126 +501,105 @@ func (uh *userHandler) updateUserHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Extract the token from the request headers
-	authHeader := r.Header.Get("Authorization")
-	if !strings.HasPrefix(authHeader, "Bearer ") {
-		RespondWithError(w, http.StatusUnauthorized, "Authorization header missing or malformed")
+	reqBody.Email, err = NormalizeEmail(reqBody.Email)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
 		return
 	}
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-
-	// Parse the token
-	token, err := jwt.ParseWithClaims(tokenString, &jwt.MapClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(uh.apiCfg.secretKey), nil
-	})
-	if err != nil || !token.Valid {
-		RespondWithError(w, http.StatusUnauthorized, "Invalid or expired token")
+	if err := validatePassword(reqBody.Password); err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	// Extract claims
-	claims, ok := token.Claims.(*jwt.MapClaims)
-	if !ok {
-		RespondWithError(w, http.StatusUnauthorized, "Invalid token claims")
-		return
-	}
-	userId, err := strconv.Atoi((*claims)["sub"].(string))
+	userId := currentUserId(r)
+	user, err := uh.db.GetUserById(userId)
 	if err != nil {
-		RespondWithError(w, http.StatusUnauthorized, "Invalid user ID in token")
+		RespondWithError(w, http.StatusInternalServerError, "Failed to update user")
 		return
 	}
 
 	// Update user in the database
-	err = uh.db.UpdateUser(userId, reqBody.Email, reqBody.Password, "")
+	err = uh.db.UpdateUser(userId, reqBody.Email, reqBody.Password)
+	if errors.Is(err, ErrEmailInUse) {
+		RespondWithError(w, http.StatusConflict, "Email already in use")
+		return
+	}
 	if err != nil {
 		RespondWithError(w, http.StatusInternalServerError, "Failed to update user")
 		return
 	}
 
+	// A changed address has to be verified again
+	emailChanged := user.Email != reqBody.Email
+	if emailChanged {
+		if err := uh.startEmailVerification(userId); err != nil {
+			log.Printf("Failed to start email verification: %v", err)
+		}
+	}
+
 	// Respond with updated user info
 	RespondWithJSON(w, http.StatusOK, map[string]interface{}{
-		"id":    userId,
-		"email": reqBody.Email,
+		"id":       userId,
+		"email":    reqBody.Email,
+		"verified": user.Verified && !emailChanged,
 	})
 }
 
 func (uh *userHandler) refreshToken(w http.ResponseWriter, r *http.Request) {
-	authHeader := r.Header.Get("Authorization")
-	if !strings.HasPrefix(authHeader, "Bearer ") {
-		RespondWithError(w, http.StatusUnauthorized, "Authorization header missing or malformed")
+	refreshToken, err := bearerToken(r)
+	if err != nil {
+		RespondWithError(w, http.StatusUnauthorized, err.Error())
 		return
 	}
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 
-	users, errU := uh.db.GetUsers()
-	if errU != nil {
-		RespondWithError(w, http.StatusUnauthorized, errU.Error())
+	newToken, err := newOpaqueToken()
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Error generating token")
 		return
-
 	}
-	for _, user := range users {
-		if user.RefreshToken == tokenString && time.Now().Before(user.RefreshExpirationDate) {
-			claims := &jwt.MapClaims{
-				"iss": "chirpy",
-				"iat": time.Now().UTC().Unix(),
-				"exp": time.Now().UTC().Add(time.Hour).Unix(),
-				"sub": strconv.Itoa(user.Id),
-			}
-			token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-			tokenString, err := token.SignedString([]byte(uh.apiCfg.secretKey))
-			if err != nil {
-				RespondWithError(w, http.StatusInternalServerError, "Error generating token")
-				return
-			}
-			RespondWithJSON(w, http.StatusOK, map[string]interface{}{
-				"token": tokenString,
-			})
-			break
-		} else {
-			RespondWithError(w, http.StatusUnauthorized, "Error generating token")
-			return
 
-		}
+	session, err := uh.db.RotateSession(refreshToken, newToken, clientIP(r), r.UserAgent())
+	if errors.Is(err, ErrRefreshTokenReused) {
+		log.Printf("Refresh token reuse on session %d of user %d from %s, session revoked",
+			session.Id, session.UserId, clientIP(r))
+		RespondWithError(w, http.StatusUnauthorized, "Invalid or expired refresh token")
+		return
 	}
-
-}
-
-func (uh *userHandler) revokeToken(w http.ResponseWriter, r *http.Request) {
-	authHeader := r.Header.Get("Authorization")
-	if !strings.HasPrefix(authHeader, "Bearer ") {
-		RespondWithError(w, http.StatusUnauthorized, "Authorization header missing or malformed")
+	if errors.Is(err, ErrNotFound) {
+		RespondWithError(w, http.StatusUnauthorized, "Invalid or expired refresh token")
 		return
 	}
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-
-	users, errU := uh.db.GetUsers()
-	if errU != nil {
-		RespondWithError(w, http.StatusUnauthorized, errU.Error())
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Error generating token")
 		return
 	}
 
-	chirps, errC := uh.db.GetChirps()
-	if errC != nil {
-		RespondWithError(w, http.StatusInternalServerError, "Error fetching chirps")
+	tokenString, claims, err := uh.apiCfg.issueAccessToken(session.UserId, uh.apiCfg.ttls.accessTTL(session.ExpiresInSeconds))
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Error generating token")
 		return
 	}
+	RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"token":                    tokenString,
+		"expires_at":               claims.ExpiresAt,
+		"expires_in_seconds":       int(claims.ExpiresAt.Sub(claims.IssuedAt).Seconds()),
+		"refresh_token":            newToken,
+		"refresh_token_expires_at": session.ExpiresAt,
+	})
+}
 
-	userFound := false
-	for i := range users {
-		if users[i].RefreshToken == tokenString {
-			userFound = true
-			users[i].RefreshToken = ""
-			pastDate := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
-			users[i].RefreshExpirationDate = pastDate
-		}
+func (uh *userHandler) revokeToken(w http.ResponseWriter, r *http.Request) {
+	refreshToken, err := bearerToken(r)
+	if err != nil {
+		RespondWithError(w, http.StatusUnauthorized, err.Error())
+		return
 	}
 
-	if !userFound {
-		RespondWithError(w, http.StatusUnauthorized, "NO user Found for this token")
+	err = uh.db.DeleteSessionByToken(refreshToken)
+	if errors.Is(err, ErrNotFound) {
+		RespondWithError(w, http.StatusUnauthorized, "Invalid refresh token")
 		return
 	}
-
-	err := uh.db.UpdateDB(users, chirps)
 	if err != nil {
 		RespondWithError(w, http.StatusInternalServerError, "Error updating database")
 		return
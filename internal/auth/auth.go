@@ -0,0 +1,177 @@
+// Package auth issues and verifies Chirpy access tokens
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrTokenExpired = errors.New("token has expired")
+)
+
+// Claims are the verified claims of an access token
+type Claims struct {
+	UserId    int
+	Issuer    string
+	Audience  string
+	IssuedAt  time.Time
+	NotBefore time.Time
+	ExpiresAt time.Time
+	// Id is the unique id of the token, its jti
+	Id string
+	// Version is the token version of the user when the token was issued.
+	// Tokens older than the user's current version are no longer honoured.
+	Version int
+}
+
+// tokenClaims is the JWT payload of an access token
+type tokenClaims struct {
+	jwt.StandardClaims
+	Version int `json:"ver"`
+}
+
+// Issuer signs access tokens with the active key of a KeyRing
+type Issuer struct {
+	keys     *KeyRing
+	issuer   string
+	audience string
+}
+
+func NewIssuer(keys *KeyRing, issuer, audience string) *Issuer {
+	return &Issuer{keys: keys, issuer: issuer, audience: audience}
+}
+
+// Issue returns a signed access token for userId at token version version
+// that is valid for ttl
+func (i *Issuer) Issue(userId, version int, ttl time.Duration) (string, Claims, error) {
+	jti, err := newTokenId()
+	if err != nil {
+		return "", Claims{}, err
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	claims := Claims{
+		UserId:    userId,
+		Issuer:    i.issuer,
+		Audience:  i.audience,
+		IssuedAt:  now,
+		NotBefore: now,
+		ExpiresAt: now.Add(ttl),
+		Id:        jti,
+		Version:   version,
+	}
+	key := i.keys.Active()
+	token := jwt.NewWithClaims(key.method(), tokenClaims{
+		StandardClaims: jwt.StandardClaims{
+			Subject:   strconv.Itoa(userId),
+			Issuer:    claims.Issuer,
+			Audience:  claims.Audience,
+			IssuedAt:  claims.IssuedAt.Unix(),
+			NotBefore: claims.NotBefore.Unix(),
+			ExpiresAt: claims.ExpiresAt.Unix(),
+			Id:        claims.Id,
+		},
+		Version: claims.Version,
+	})
+	token.Header["kid"] = key.Id
+	signed, err := token.SignedString(key.private)
+	if err != nil {
+		return "", Claims{}, err
+	}
+	return signed, claims, nil
+}
+
+// Verifier checks access tokens against the public keys of a KeyRing. Clock
+// skew of up to leeway is tolerated on the time based claims.
+type Verifier struct {
+	keys     *KeyRing
+	issuer   string
+	audience string
+	leeway   time.Duration
+}
+
+func NewVerifier(keys *KeyRing, issuer, audience string, leeway time.Duration) *Verifier {
+	return &Verifier{keys: keys, issuer: issuer, audience: audience, leeway: leeway}
+}
+
+// Verify checks the signature, algorithm, issuer, audience and validity
+// period of token and returns its claims
+func (v *Verifier) Verify(token string) (Claims, error) {
+	// The time based claims are checked below, with leeway
+	parser := jwt.Parser{
+		ValidMethods:         []string{AlgRS256, AlgEdDSA},
+		SkipClaimsValidation: true,
+	}
+	var payload tokenClaims
+	_, err := parser.ParseWithClaims(token, &payload, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		key, err := v.keys.Key(kid)
+		if err != nil {
+			return nil, err
+		}
+		// Each key only verifies the algorithm it was generated for
+		if t.Method.Alg() != key.Alg {
+			return nil, fmt.Errorf("key %s is not a %s key", kid, t.Method.Alg())
+		}
+		return key.publicKey(), nil
+	})
+	if err != nil {
+		return Claims{}, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	std := payload.StandardClaims
+
+	if std.Issuer != v.issuer {
+		return Claims{}, fmt.Errorf("%w: unexpected issuer %q", ErrInvalidToken, std.Issuer)
+	}
+	if std.Audience != v.audience {
+		return Claims{}, fmt.Errorf("%w: unexpected audience %q", ErrInvalidToken, std.Audience)
+	}
+	if std.Id == "" {
+		return Claims{}, fmt.Errorf("%w: missing jti", ErrInvalidToken)
+	}
+	userId, err := strconv.Atoi(std.Subject)
+	if err != nil {
+		return Claims{}, fmt.Errorf("%w: invalid subject", ErrInvalidToken)
+	}
+
+	now := time.Now()
+	if std.ExpiresAt == 0 {
+		return Claims{}, fmt.Errorf("%w: missing exp", ErrInvalidToken)
+	}
+	expiresAt := time.Unix(std.ExpiresAt, 0)
+	if now.After(expiresAt.Add(v.leeway)) {
+		return Claims{}, ErrTokenExpired
+	}
+	notBefore := time.Unix(std.NotBefore, 0)
+	if now.Add(v.leeway).Before(notBefore) {
+		return Claims{}, fmt.Errorf("%w: not valid yet", ErrInvalidToken)
+	}
+
+	return Claims{
+		UserId:    userId,
+		Issuer:    std.Issuer,
+		Audience:  std.Audience,
+		IssuedAt:  time.Unix(std.IssuedAt, 0).UTC(),
+		NotBefore: notBefore.UTC(),
+		ExpiresAt: expiresAt.UTC(),
+		Id:        std.Id,
+		Version:   payload.Version,
+	}, nil
+}
+
+// newTokenId returns a random jti
+func newTokenId() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
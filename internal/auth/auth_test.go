@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+const (
+	testIssuer   = "chirpy"
+	testAudience = "chirpy"
+	testLeeway   = 30 * time.Second
+)
+
+func newTestRing(t *testing.T, alg string) *KeyRing {
+	t.Helper()
+	ring, err := LoadKeyRing(t.TempDir(), alg)
+	if err != nil {
+		t.Fatalf("LoadKeyRing: %v", err)
+	}
+	return ring
+}
+
+// validClaims returns the payload of a token the test verifier accepts
+func validClaims() tokenClaims {
+	now := time.Now()
+	return tokenClaims{StandardClaims: jwt.StandardClaims{
+		Subject:   strconv.Itoa(7),
+		Issuer:    testIssuer,
+		Audience:  testAudience,
+		IssuedAt:  now.Unix(),
+		NotBefore: now.Unix(),
+		ExpiresAt: now.Add(time.Hour).Unix(),
+		Id:        "jti",
+	}}
+}
+
+// sign signs claims with method and secret under key id kid
+func sign(t *testing.T, method jwt.SigningMethod, kid string, secret interface{}, claims tokenClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(secret)
+	if err != nil {
+		t.Fatalf("signing test token: %v", err)
+	}
+	return signed
+}
+
+func TestVerifyIssuedToken(t *testing.T) {
+	for _, alg := range []string{AlgEdDSA, AlgRS256} {
+		ring := newTestRing(t, alg)
+		token, issued, err := NewIssuer(ring, testIssuer, testAudience).Issue(7, 3, time.Hour)
+		if err != nil {
+			t.Fatalf("%s: Issue: %v", alg, err)
+		}
+		claims, err := NewVerifier(ring, testIssuer, testAudience, testLeeway).Verify(token)
+		if err != nil {
+			t.Fatalf("%s: Verify: %v", alg, err)
+		}
+		if claims != issued {
+			t.Errorf("%s: verified claims = %+v, want %+v", alg, claims, issued)
+		}
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	ring := newTestRing(t, AlgEdDSA)
+	active := ring.Active()
+	other := newTestRing(t, AlgEdDSA).Active()
+	rsaKey := newTestRing(t, AlgRS256).Active()
+	verifier := NewVerifier(ring, testIssuer, testAudience, testLeeway)
+
+	wrongIssuer := validClaims()
+	wrongIssuer.Issuer = "someone-else"
+	wrongAudience := validClaims()
+	wrongAudience.Audience = "someone-else"
+	expired := validClaims()
+	expired.ExpiresAt = time.Now().Add(-testLeeway - time.Minute).Unix()
+
+	tests := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"alg none", sign(t, jwt.SigningMethodNone, active.Id, jwt.UnsafeAllowNoneSignatureType, validClaims()), ErrInvalidToken},
+		// An HMAC keyed with the public key is the classic algorithm confusion
+		{"HS256", sign(t, jwt.SigningMethodHS256, active.Id, []byte(active.publicKey().(ed25519.PublicKey)), validClaims()), ErrInvalidToken},
+		{"RS256 under an EdDSA kid", sign(t, rsaKey.method(), active.Id, rsaKey.private, validClaims()), ErrInvalidToken},
+		{"wrong issuer", sign(t, active.method(), active.Id, active.private, wrongIssuer), ErrInvalidToken},
+		{"wrong audience", sign(t, active.method(), active.Id, active.private, wrongAudience), ErrInvalidToken},
+		{"expired", sign(t, active.method(), active.Id, active.private, expired), ErrTokenExpired},
+		{"key not in the ring", sign(t, other.method(), other.Id, other.private, validClaims()), ErrInvalidToken},
+		{"kid of the ring, other key", sign(t, other.method(), active.Id, other.private, validClaims()), ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		if _, err := verifier.Verify(tt.token); !errors.Is(err, tt.want) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,328 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// Supported signing algorithms
+const (
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+const (
+	rsaKeyBits = 2048
+	// createdAtHeader is the PEM header recording when a key was generated
+	createdAtHeader = "Created-At"
+	// activatesAtHeader records when a key starts signing tokens
+	activatesAtHeader = "Activates-At"
+)
+
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// SigningKey is one private key of a KeyRing
+type SigningKey struct {
+	Id        string
+	Alg       string
+	CreatedAt time.Time
+	// ActivatesAt is when the key starts signing tokens. Until then it is
+	// only published, so verifiers can fetch it before they meet it.
+	ActivatesAt time.Time
+	private     crypto.Signer
+}
+
+func (k *SigningKey) method() jwt.SigningMethod {
+	return jwt.GetSigningMethod(k.Alg)
+}
+
+func (k *SigningKey) publicKey() crypto.PublicKey {
+	return k.private.Public()
+}
+
+// KeyRing holds the keys tokens are signed and verified with, stored as one
+// PKCS #8 PEM file per key in a directory, named after the key id. The newest
+// key that has activated signs new tokens; a newer one may be pending. Older
+// keys are kept to verify the tokens they signed until they are pruned.
+type KeyRing struct {
+	dir string
+	alg string
+	mu  sync.RWMutex
+	// keys is sorted by activation, oldest first
+	keys []*SigningKey
+}
+
+// LoadKeyRing loads the keys in dir, generating a first alg key if there are none
+func LoadKeyRing(dir, alg string) (*KeyRing, error) {
+	if alg != AlgRS256 && alg != AlgEdDSA {
+		return nil, fmt.Errorf("unsupported signing algorithm %q", alg)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	ring := &KeyRing{dir: dir, alg: alg}
+	for _, path := range paths {
+		key, err := readKey(path)
+		if err != nil {
+			return nil, fmt.Errorf("loading %s: %w", path, err)
+		}
+		ring.keys = append(ring.keys, key)
+	}
+	// Keys made within the same second have equal creation times, so they
+	// are ordered by when they sign
+	sort.Slice(ring.keys, func(i, j int) bool {
+		a, b := ring.keys[i], ring.keys[j]
+		if !a.ActivatesAt.Equal(b.ActivatesAt) {
+			return a.ActivatesAt.Before(b.ActivatesAt)
+		}
+		return a.CreatedAt.Before(b.CreatedAt)
+	})
+
+	if len(ring.keys) == 0 {
+		if _, err := ring.Rotate(time.Now(), 0); err != nil {
+			return nil, err
+		}
+	}
+	return ring, nil
+}
+
+// Active returns the key new tokens are signed with
+func (kr *KeyRing) Active() *SigningKey {
+	return kr.ActiveAt(time.Now())
+}
+
+// ActiveAt returns the key that signs new tokens at now
+func (kr *KeyRing) ActiveAt(now time.Time) *SigningKey {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+	return kr.active(now)
+}
+
+func (kr *KeyRing) active(now time.Time) *SigningKey {
+	for i := len(kr.keys) - 1; i >= 0; i-- {
+		if !now.Before(kr.keys[i].ActivatesAt) {
+			return kr.keys[i]
+		}
+	}
+	// Only pending keys, e.g. after the clock went back; better than none
+	return kr.keys[0]
+}
+
+// Pending returns the key that has been published but does not sign yet,
+// or nil if there is none
+func (kr *KeyRing) Pending(now time.Time) *SigningKey {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+	newest := kr.keys[len(kr.keys)-1]
+	if now.Before(newest.ActivatesAt) {
+		return newest
+	}
+	return nil
+}
+
+// Key returns the key with id kid
+func (kr *KeyRing) Key(kid string) (*SigningKey, error) {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+	for _, key := range kr.keys {
+		if key.Id == kid {
+			return key, nil
+		}
+	}
+	return nil, ErrUnknownKey
+}
+
+// Rotate generates a new key, stores it and publishes it. It becomes the
+// active key after delay, which should be at least as long as verifiers
+// cache the JWKS. The previous keys stay available for verification.
+func (kr *KeyRing) Rotate(now time.Time, delay time.Duration) (*SigningKey, error) {
+	key, err := generateKey(kr.alg, now)
+	if err != nil {
+		return nil, err
+	}
+	key.ActivatesAt = key.CreatedAt.Add(delay)
+	if err := writeKey(filepath.Join(kr.dir, key.Id+".pem"), key); err != nil {
+		return nil, err
+	}
+
+	kr.mu.Lock()
+	kr.keys = append(kr.keys, key)
+	kr.mu.Unlock()
+	return key, nil
+}
+
+// Prune deletes the keys that were replaced by a newer active key more than
+// overlap ago. overlap must be at least the lifetime of the tokens they signed.
+func (kr *KeyRing) Prune(now time.Time, overlap time.Duration) error {
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+
+	kept := make([]*SigningKey, 0, len(kr.keys))
+	for i, key := range kr.keys {
+		if i < len(kr.keys)-1 && now.Sub(kr.keys[i+1].ActivatesAt) > overlap {
+			if err := os.Remove(filepath.Join(kr.dir, key.Id+".pem")); err != nil && !os.IsNotExist(err) {
+				kr.keys = append(kept, kr.keys[i:]...)
+				return err
+			}
+			continue
+		}
+		kept = append(kept, key)
+	}
+	kr.keys = kept
+	return nil
+}
+
+// JWK is the public half of a signing key in JSON Web Key form (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	// RSA keys
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519 keys (RFC 8037)
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys of every key in the ring, pending ones
+// included, newest first
+func (kr *KeyRing) JWKS() JWKSet {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+
+	set := JWKSet{Keys: make([]JWK, 0, len(kr.keys))}
+	for i := len(kr.keys) - 1; i >= 0; i-- {
+		key := kr.keys[i]
+		jwk := JWK{Use: "sig", Alg: key.Alg, Kid: key.Id}
+		switch pub := key.publicKey().(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
+
+func generateKey(alg string, now time.Time) (*SigningKey, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	key := &SigningKey{
+		Id:        hex.EncodeToString(id),
+		Alg:       alg,
+		CreatedAt: now.UTC().Truncate(time.Second),
+	}
+
+	var err error
+	switch alg {
+	case AlgRS256:
+		key.private, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	case AlgEdDSA:
+		_, key.private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		err = fmt.Errorf("unsupported signing algorithm %q", alg)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func writeKey(path string, key *SigningKey) error {
+	der, err := x509.MarshalPKCS8PrivateKey(key.private)
+	if err != nil {
+		return err
+	}
+	block := &pem.Block{
+		Type: "PRIVATE KEY",
+		Headers: map[string]string{
+			createdAtHeader:   key.CreatedAt.Format(time.RFC3339),
+			activatesAtHeader: key.ActivatesAt.Format(time.RFC3339),
+		},
+		Bytes: der,
+	}
+	return os.WriteFile(path, pem.EncodeToMemory(block), 0600)
+}
+
+func readKey(path string) (*SigningKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, errors.New("no PKCS #8 private key found")
+	}
+	private, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &SigningKey{Id: strings.TrimSuffix(filepath.Base(path), ".pem")}
+	switch private := private.(type) {
+	case *rsa.PrivateKey:
+		key.Alg, key.private = AlgRS256, private
+	case ed25519.PrivateKey:
+		key.Alg, key.private = AlgEdDSA, private
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", private)
+	}
+
+	// Keys without the header, e.g. added by hand, fall back to the file time
+	if createdAt, ok := block.Headers[createdAtHeader]; ok {
+		key.CreatedAt, err = time.Parse(time.RFC3339, createdAt)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s header: %w", createdAtHeader, err)
+		}
+	} else {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		key.CreatedAt = info.ModTime().UTC()
+	}
+	// Keys from before activation was delayed signed as soon as they existed
+	key.ActivatesAt = key.CreatedAt
+	if activatesAt, ok := block.Headers[activatesAtHeader]; ok {
+		key.ActivatesAt, err = time.Parse(time.RFC3339, activatesAt)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s header: %w", activatesAtHeader, err)
+		}
+	}
+	return key, nil
+}
@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+func TestPendingKeyIsPublishedBeforeItSigns(t *testing.T) {
+	dir := t.TempDir()
+	ring, err := LoadKeyRing(dir, AlgEdDSA)
+	if err != nil {
+		t.Fatalf("LoadKeyRing: %v", err)
+	}
+	current := ring.Active()
+
+	now := time.Now()
+	pending, err := ring.Rotate(now, time.Hour)
+	if err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+
+	// Reloading from disk must keep the activation time
+	reloaded, err := LoadKeyRing(dir, AlgEdDSA)
+	if err != nil {
+		t.Fatalf("LoadKeyRing: %v", err)
+	}
+	for name, kr := range map[string]*KeyRing{"ring": ring, "reloaded ring": reloaded} {
+		published := false
+		for _, jwk := range kr.JWKS().Keys {
+			published = published || jwk.Kid == pending.Id
+		}
+		if !published {
+			t.Errorf("%s: pending key missing from the JWKS", name)
+		}
+		if got := kr.Pending(now); got == nil || got.Id != pending.Id {
+			t.Errorf("%s: Pending = %v, want %s", name, got, pending.Id)
+		}
+		if got := kr.Active(); got.Id != current.Id {
+			t.Errorf("%s: Active = %s before activation, want %s", name, got.Id, current.Id)
+		}
+
+		token, _, err := NewIssuer(kr, testIssuer, testAudience).Issue(7, 0, time.Hour)
+		if err != nil {
+			t.Fatalf("%s: Issue: %v", name, err)
+		}
+		parsed, _, err := new(jwt.Parser).ParseUnverified(token, &tokenClaims{})
+		if err != nil {
+			t.Fatalf("%s: parsing issued token: %v", name, err)
+		}
+		if kid := parsed.Header["kid"]; kid != current.Id {
+			t.Errorf("%s: token signed by %v before activation, want %s", name, kid, current.Id)
+		}
+
+		// Once activated, the new key signs
+		if got := kr.active(pending.ActivatesAt); got.Id != pending.Id {
+			t.Errorf("%s: active key at activation = %s, want %s", name, got.Id, pending.Id)
+		}
+		if got := kr.Pending(pending.ActivatesAt); got != nil {
+			t.Errorf("%s: Pending at activation = %s, want none", name, got.Id)
+		}
+	}
+}
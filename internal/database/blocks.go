@@ -0,0 +1,119 @@
+package database
+
+import (
+	"errors"
+	"time"
+
+	. "github.com/mohamed2394/goserver/internal"
+)
+
+var ErrSelfRelation = errors.New("users can't block or mute themselves")
+
+// Block makes blockerId block blockedId and removes any follow edge between them
+func (db *DB) Block(blockerId, blockedId int) error {
+	if blockerId == blockedId {
+		return ErrSelfRelation
+	}
+	return db.update(func(dbs *DBStructure) error {
+		if _, ok := dbs.Users[blockedId]; !ok {
+			return ErrNotFound
+		}
+		addEdge(dbs.Blocks, blockerId, blockedId)
+		dbs.removeFollow(blockerId, blockedId)
+		dbs.removeFollow(blockedId, blockerId)
+		dbs.removeFromLists(blockerId, blockedId)
+		dbs.removeFromLists(blockedId, blockerId)
+		return nil
+	})
+}
+
+// Unblock removes a block
+func (db *DB) Unblock(blockerId, blockedId int) error {
+	return db.update(func(dbs *DBStructure) error {
+		return removeEdge(dbs.Blocks, blockerId, blockedId)
+	})
+}
+
+// Mute hides mutedId's chirps from muterId's listings and timeline
+func (db *DB) Mute(muterId, mutedId int) error {
+	if muterId == mutedId {
+		return ErrSelfRelation
+	}
+	return db.update(func(dbs *DBStructure) error {
+		if _, ok := dbs.Users[mutedId]; !ok {
+			return ErrNotFound
+		}
+		addEdge(dbs.Mutes, muterId, mutedId)
+		return nil
+	})
+}
+
+// Unmute removes a mute
+func (db *DB) Unmute(muterId, mutedId int) error {
+	return db.update(func(dbs *DBStructure) error {
+		return removeEdge(dbs.Mutes, muterId, mutedId)
+	})
+}
+
+// GetRelations returns who userId follows, blocks and mutes, who blocks them,
+// and the groups they belong to
+func (db *DB) GetRelations(userId int) (Relations, error) {
+	dbs, err := db.readDB()
+	if err != nil {
+		return Relations{}, err
+	}
+	return dbs.relations(userId), nil
+}
+
+func (dbs *DBStructure) relations(userId int) Relations {
+	rel := Relations{
+		Following: idSet(dbs.Following[userId]),
+		Blocked:   idSet(dbs.Blocks[userId]),
+		BlockedBy: make(map[int]bool),
+		Muted:     idSet(dbs.Mutes[userId]),
+		Groups:    make(map[int]bool),
+	}
+	for blockerId, blocked := range dbs.Blocks {
+		if _, ok := blocked[userId]; ok {
+			rel.BlockedBy[blockerId] = true
+		}
+	}
+	for groupId, members := range dbs.GroupMembers {
+		if _, ok := members[userId]; ok {
+			rel.Groups[groupId] = true
+		}
+	}
+	return rel
+}
+
+// isBlocked reports whether either user has blocked the other
+func (dbs *DBStructure) isBlocked(a, b int) bool {
+	_, aBlockedB := dbs.Blocks[a][b]
+	_, bBlockedA := dbs.Blocks[b][a]
+	return aBlockedB || bBlockedA
+}
+
+func addEdge(edges map[int]map[int]time.Time, from, to int) {
+	if edges[from] == nil {
+		edges[from] = make(map[int]time.Time)
+	}
+	if _, ok := edges[from][to]; !ok {
+		edges[from][to] = time.Now().UTC()
+	}
+}
+
+func removeEdge(edges map[int]map[int]time.Time, from, to int) error {
+	if _, ok := edges[from][to]; !ok {
+		return ErrNotFound
+	}
+	delete(edges[from], to)
+	return nil
+}
+
+func idSet(edges map[int]time.Time) map[int]bool {
+	set := make(map[int]bool, len(edges))
+	for id := range edges {
+		set[id] = true
+	}
+	return set
+}
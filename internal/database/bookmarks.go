@@ -0,0 +1,128 @@
+package database
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	. "github.com/mohamed2394/goserver/internal"
+)
+
+var (
+	ErrNotChirpAuthor = errors.New("chirp belongs to another user")
+	ErrTooManyPins    = errors.New("pinned chirp limit reached")
+)
+
+// AddBookmark bookmarks a chirp for userId. Bookmarking twice is a no-op.
+func (db *DB) AddBookmark(userId, chirpId int) error {
+	return db.update(func(dbs *DBStructure) error {
+		if _, ok := dbs.Chirps[chirpId]; !ok {
+			return ErrNotFound
+		}
+		bookmarks := dbs.Bookmarks[userId]
+		if bookmarks == nil {
+			bookmarks = make(map[int]time.Time)
+			dbs.Bookmarks[userId] = bookmarks
+		}
+		if _, ok := bookmarks[chirpId]; !ok {
+			bookmarks[chirpId] = time.Now().UTC()
+		}
+		return nil
+	})
+}
+
+// RemoveBookmark removes a bookmark of userId
+func (db *DB) RemoveBookmark(userId, chirpId int) error {
+	return db.update(func(dbs *DBStructure) error {
+		if _, ok := dbs.Bookmarks[userId][chirpId]; !ok {
+			return ErrNotFound
+		}
+		delete(dbs.Bookmarks[userId], chirpId)
+		return nil
+	})
+}
+
+// GetBookmarks returns the bookmarks of userId, most recent first
+func (db *DB) GetBookmarks(userId int) ([]Bookmark, error) {
+	dbs, err := db.readDB()
+	if err != nil {
+		return nil, err
+	}
+
+	bookmarks := []Bookmark{}
+	for chirpId, createdAt := range dbs.Bookmarks[userId] {
+		chirp, ok := dbs.Chirps[chirpId]
+		if !ok {
+			continue
+		}
+		bookmarks = append(bookmarks, Bookmark{Chirp: chirp, CreatedAt: createdAt})
+	}
+	sort.Slice(bookmarks, func(i, j int) bool {
+		if bookmarks[i].CreatedAt.Equal(bookmarks[j].CreatedAt) {
+			return bookmarks[i].Chirp.Id > bookmarks[j].Chirp.Id
+		}
+		return bookmarks[i].CreatedAt.After(bookmarks[j].CreatedAt)
+	})
+	return bookmarks, nil
+}
+
+// PinChirp pins one of userId's own chirps to their profile, keeping at most
+// maxPinned. Pinning an already pinned chirp moves it to the front.
+func (db *DB) PinChirp(userId, chirpId, maxPinned int) error {
+	return db.update(func(dbs *DBStructure) error {
+		chirp, ok := dbs.Chirps[chirpId]
+		if !ok {
+			return ErrNotFound
+		}
+		if chirp.AuthorId != userId {
+			return ErrNotChirpAuthor
+		}
+
+		pinned := removeId(dbs.PinnedChirps[userId], chirpId)
+		if len(pinned) >= maxPinned {
+			return ErrTooManyPins
+		}
+		dbs.PinnedChirps[userId] = append([]int{chirpId}, pinned...)
+		return nil
+	})
+}
+
+// UnpinChirp removes a chirp from userId's pinned chirps
+func (db *DB) UnpinChirp(userId, chirpId int) error {
+	return db.update(func(dbs *DBStructure) error {
+		pinned := dbs.PinnedChirps[userId]
+		kept := removeId(append([]int(nil), pinned...), chirpId)
+		if len(kept) == len(pinned) {
+			return ErrNotFound
+		}
+		dbs.PinnedChirps[userId] = kept
+		return nil
+	})
+}
+
+// GetChirpsByAuthor returns the chirps of authorId with their pinned chirps
+// first, in pin order, followed by the rest newest first
+func (db *DB) GetChirpsByAuthor(authorId int) ([]Chirp, error) {
+	dbs, err := db.readDB()
+	if err != nil {
+		return nil, err
+	}
+
+	chirps := []Chirp{}
+	pinned := make(map[int]bool)
+	for _, id := range dbs.PinnedChirps[authorId] {
+		if chirp, ok := dbs.Chirps[id]; ok {
+			chirps = append(chirps, chirp)
+			pinned[id] = true
+		}
+	}
+
+	var rest []Chirp
+	for _, chirp := range dbs.Chirps {
+		if chirp.AuthorId == authorId && !pinned[chirp.Id] {
+			rest = append(rest, chirp)
+		}
+	}
+	sort.Slice(rest, func(i, j int) bool { return rest[i].Id > rest[j].Id })
+	return append(chirps, rest...), nil
+}
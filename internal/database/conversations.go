@@ -0,0 +1,187 @@
+package database
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	. "github.com/mohamed2394/goserver/internal"
+)
+
+var ErrSelfConversation = errors.New("users can't message themselves")
+
+// GetOrCreateConversation returns the conversation between userId and
+// recipientId, starting one if they have none yet. created reports whether it
+// is new.
+func (db *DB) GetOrCreateConversation(userId, recipientId int) (conversation ConversationSummary, created bool, err error) {
+	if userId == recipientId {
+		return ConversationSummary{}, false, ErrSelfConversation
+	}
+	err = db.update(func(dbs *DBStructure) error {
+		if _, ok := dbs.Users[recipientId]; !ok {
+			return ErrNotFound
+		}
+		if dbs.isBlocked(userId, recipientId) {
+			return ErrBlocked
+		}
+
+		for _, existing := range dbs.Conversations {
+			if existing.HasParticipant(userId) && existing.HasParticipant(recipientId) {
+				conversation = dbs.conversationSummary(existing, userId)
+				return nil
+			}
+		}
+
+		now := time.Now().UTC()
+		newConversation := Conversation{
+			Id:             nextId(dbs.Conversations),
+			ParticipantIds: []int{userId, recipientId},
+			LastRead:       map[int]int{},
+			CreatedAt:      now,
+			LastMessageAt:  now,
+		}
+		dbs.Conversations[newConversation.Id] = newConversation
+		conversation = dbs.conversationSummary(newConversation, userId)
+		created = true
+		return nil
+	})
+	return conversation, created, err
+}
+
+// GetConversations returns userId's conversations, most recently active first
+func (db *DB) GetConversations(userId int) ([]ConversationSummary, error) {
+	dbs, err := db.readDB()
+	if err != nil {
+		return nil, err
+	}
+
+	conversations := []ConversationSummary{}
+	for _, conversation := range dbs.Conversations {
+		if conversation.HasParticipant(userId) {
+			conversations = append(conversations, dbs.conversationSummary(conversation, userId))
+		}
+	}
+	sort.Slice(conversations, func(i, j int) bool {
+		if conversations[i].LastMessageAt.Equal(conversations[j].LastMessageAt) {
+			return conversations[i].Id > conversations[j].Id
+		}
+		return conversations[i].LastMessageAt.After(conversations[j].LastMessageAt)
+	})
+	return conversations, nil
+}
+
+// GetConversation returns a conversation if userId takes part in it
+func (db *DB) GetConversation(id, userId int) (ConversationSummary, error) {
+	dbs, err := db.readDB()
+	if err != nil {
+		return ConversationSummary{}, err
+	}
+	conversation, ok := dbs.Conversations[id]
+	if !ok || !conversation.HasParticipant(userId) {
+		return ConversationSummary{}, ErrNotFound
+	}
+	return dbs.conversationSummary(conversation, userId), nil
+}
+
+// GetMessages returns the messages of a conversation userId takes part in, newest first
+func (db *DB) GetMessages(conversationId, userId int) ([]Message, error) {
+	dbs, err := db.readDB()
+	if err != nil {
+		return nil, err
+	}
+	conversation, ok := dbs.Conversations[conversationId]
+	if !ok || !conversation.HasParticipant(userId) {
+		return nil, ErrNotFound
+	}
+
+	stored := dbs.Messages[conversationId]
+	messages := make([]Message, 0, len(stored))
+	for i := len(stored) - 1; i >= 0; i-- {
+		messages = append(messages, stored[i])
+	}
+	return messages, nil
+}
+
+// CreateMessage adds a message from senderId to a conversation. Sending a
+// message also marks the conversation read up to it for the sender.
+func (db *DB) CreateMessage(conversationId, senderId int, body string) (Message, error) {
+	var message Message
+	err := db.update(func(dbs *DBStructure) error {
+		conversation, ok := dbs.Conversations[conversationId]
+		if !ok || !conversation.HasParticipant(senderId) {
+			return ErrNotFound
+		}
+		for _, participantId := range conversation.ParticipantIds {
+			if participantId != senderId && dbs.isBlocked(senderId, participantId) {
+				return ErrBlocked
+			}
+		}
+
+		messages := dbs.Messages[conversationId]
+		message = Message{
+			Id:             1,
+			ConversationId: conversationId,
+			SenderId:       senderId,
+			Body:           body,
+			CreatedAt:      time.Now().UTC(),
+		}
+		if len(messages) > 0 {
+			message.Id = messages[len(messages)-1].Id + 1
+		}
+		dbs.Messages[conversationId] = append(messages, message)
+
+		if conversation.LastRead == nil {
+			conversation.LastRead = map[int]int{}
+		}
+		conversation.LastRead[senderId] = message.Id
+		conversation.LastMessageAt = message.CreatedAt
+		dbs.Conversations[conversationId] = conversation
+		return nil
+	})
+	return message, err
+}
+
+// MarkConversationRead records that userId has read the conversation up to
+// messageId, or up to the latest message if messageId is 0. The read marker
+// never moves backwards.
+func (db *DB) MarkConversationRead(conversationId, userId, messageId int) error {
+	return db.update(func(dbs *DBStructure) error {
+		conversation, ok := dbs.Conversations[conversationId]
+		if !ok || !conversation.HasParticipant(userId) {
+			return ErrNotFound
+		}
+
+		messages := dbs.Messages[conversationId]
+		latest := 0
+		if len(messages) > 0 {
+			latest = messages[len(messages)-1].Id
+		}
+		if messageId == 0 {
+			messageId = latest
+		}
+		if messageId < 0 || messageId > latest {
+			return ErrNotFound
+		}
+
+		if conversation.LastRead == nil {
+			conversation.LastRead = map[int]int{}
+		}
+		if messageId > conversation.LastRead[userId] {
+			conversation.LastRead[userId] = messageId
+		}
+		dbs.Conversations[conversationId] = conversation
+		return nil
+	})
+}
+
+// conversationSummary counts the messages from other participants that userId hasn't read
+func (dbs *DBStructure) conversationSummary(conversation Conversation, userId int) ConversationSummary {
+	summary := ConversationSummary{Conversation: conversation}
+	lastRead := conversation.LastRead[userId]
+	for _, message := range dbs.Messages[conversation.Id] {
+		if message.Id > lastRead && message.SenderId != userId {
+			summary.UnreadCount++
+		}
+	}
+	return summary
+}
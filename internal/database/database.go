@@ -19,153 +19,208 @@ type DB struct {
 	Path           string
 	ChirpIdCounter int
 	UserIdCounter  int
-	Mux            *sync.RWMutex
+	// SessionIdCounter never hands out an id that a session, retired
+	// refresh token or security event still refers to
+	SessionIdCounter int
+	Mux              *sync.RWMutex
 }
 
 type DBStructure struct {
-	Chirps map[int]Chirp `json:"chirps"`
-	Users  map[int]User  `json:"users"`
+	Chirps          map[int]Chirp          `json:"chirps"`
+	Users           map[int]User           `json:"users"`
+	ScheduledChirps map[int]ScheduledChirp `json:"scheduled_chirps"`
+	Drafts          map[int]Draft          `json:"drafts"`
+	// PollVotes maps a chirp id to the option each user voted for
+	PollVotes map[int]map[int]int `json:"poll_votes"`
+	// Bookmarks maps a user id to the chirps they bookmarked and when
+	Bookmarks map[int]map[int]time.Time `json:"bookmarks"`
+	// PinnedChirps maps a user id to their pinned chirp ids, most recent first
+	PinnedChirps map[int][]int `json:"pinned_chirps"`
+	// Following and Followers index the same follow edges from both ends:
+	// Following[follower][followee] and Followers[followee][follower] both
+	// hold the time the follow started
+	Following map[int]map[int]time.Time `json:"following"`
+	Followers map[int]map[int]time.Time `json:"followers"`
+	// Inboxes holds the home timeline chirp ids delivered to each user,
+	// oldest first. Ids of deleted chirps are skipped on read.
+	Inboxes map[int][]int `json:"inboxes"`
+	// Blocks and Mutes map a user id to the users they blocked or muted and when
+	Blocks map[int]map[int]time.Time `json:"blocks"`
+	Mutes  map[int]map[int]time.Time `json:"mutes"`
+	// Handles maps each lowercased handle in use to its user id
+	Handles map[string]int `json:"handles"`
+	// ReservedHandles holds handles recently given up, keyed by lowercased handle
+	ReservedHandles map[string]HandleReservation `json:"reserved_handles"`
+	Conversations   map[int]Conversation         `json:"conversations"`
+	// Messages maps a conversation id to its messages, oldest first
+	Messages      map[int][]Message    `json:"messages"`
+	Notifications map[int]Notification `json:"notifications"`
+	Lists         map[int]List         `json:"lists"`
+	Groups        map[int]Group        `json:"groups"`
+	// GroupMembers maps a group id to its members, keyed by user id
+	GroupMembers map[int]map[int]GroupMember `json:"group_members"`
+	Sessions     map[int]Session             `json:"sessions"`
+	// SessionsByToken indexes Sessions by the hash of their refresh token
+	SessionsByToken map[string]int `json:"sessions_by_token"`
+	// RetiredTokens holds the hashes of rotated refresh tokens until their
+	// session would have expired, to detect them being replayed
+	RetiredTokens  map[string]RetiredToken `json:"retired_tokens"`
+	SecurityEvents map[int]SecurityEvent   `json:"security_events"`
+	// NextSessionId is the id the next session gets. Session ids are never
+	// reused, even once nothing refers to them any more.
+	NextSessionId int `json:"next_session_id,omitempty"`
+	// RevokedAccessTokens maps the jti of each revoked access token to the
+	// time the token expires anyway
+	RevokedAccessTokens map[string]time.Time `json:"revoked_access_tokens"`
+	// PasswordResets is keyed by the hash of the reset token
+	PasswordResets map[string]PasswordReset `json:"password_resets"`
+	// EmailVerifications is keyed by the hash of the verification token
+	EmailVerifications map[string]EmailVerification `json:"email_verifications"`
+	TwoFactor          map[int]TwoFactor            `json:"two_factor"`
+	// MFAChallenges is keyed by the hash of the challenge token
+	MFAChallenges map[string]MFAChallenge `json:"mfa_challenges"`
 }
 
+var (
+	// ErrNotFound is returned when a requested record does not exist
+	ErrNotFound   = errors.New("not found")
+	ErrEmailInUse = errors.New("email already in use")
+)
+
 // NewDB creates a new database connection
 // and creates the database file if it doesn't exist
 func NewDB(path string) (*DB, error) {
 	db := DB{
-		Path:           path,
-		ChirpIdCounter: 1,
-		UserIdCounter:  1,
-		Mux:            &sync.RWMutex{},
+		Path:             path,
+		ChirpIdCounter:   1,
+		UserIdCounter:    1,
+		SessionIdCounter: 1,
+		Mux:              &sync.RWMutex{},
 	}
 	err := db.ensureDB()
 	if err != nil {
 		return nil, err
 	}
-	return &db, nil
-}
 
-// CreateChirp creates a new chirp and saves it to disk
-func (db *DB) CreateChirp(body string) (Chirp, error) {
-	log.Println("Creating a new chirp")
-
-	chirp := Chirp{
-		Id:   db.ChirpIdCounter,
-		Body: body,
+	// Continue numbering after the records that are already on disk so a
+	// restart doesn't hand out ids that are still in use
+	dbs, err := db.readDB()
+	if err != nil {
+		return nil, err
 	}
-	db.ChirpIdCounter++
-	log.Printf("Assigned chirp ID: %d", chirp.Id)
-
-	chirps, errC := db.GetChirps()
-	if errC != nil {
-		log.Println("Error getting chirps:", errC)
-		return Chirp{}, errC
+	for id := range dbs.Chirps {
+		if id >= db.ChirpIdCounter {
+			db.ChirpIdCounter = id + 1
+		}
 	}
-
-	chirps = append(chirps, chirp)
-	users, errH := db.GetUsers()
-	if errH != nil {
-		log.Println("Error getting Users:", errC)
-		return Chirp{}, errC
+	for id := range dbs.ScheduledChirps {
+		if id >= db.ChirpIdCounter {
+			db.ChirpIdCounter = id + 1
+		}
+	}
+	for id := range dbs.Users {
+		if id >= db.UserIdCounter {
+			db.UserIdCounter = id + 1
+		}
+	}
+	sessionIds := []int{}
+	for id := range dbs.Sessions {
+		sessionIds = append(sessionIds, id)
 	}
+	for _, retired := range dbs.RetiredTokens {
+		sessionIds = append(sessionIds, retired.SessionId)
+	}
+	for _, event := range dbs.SecurityEvents {
+		sessionIds = append(sessionIds, event.SessionId)
+	}
+	for _, id := range sessionIds {
+		if id >= db.SessionIdCounter {
+			db.SessionIdCounter = id + 1
+		}
+	}
+	db.SessionIdCounter = max(db.SessionIdCounter, dbs.NextSessionId)
 
-	errU := db.UpdateDB(users, chirps)
-	if errU != nil {
-		log.Println("Error writing database:", errU)
-		return Chirp{}, errU
+	if err := db.migrateUsers(); err != nil {
+		return nil, err
 	}
-	log.Println("Successfully created a new user")
-	return chirp, nil
+	return &db, nil
 }
 
-func (db *DB) CreateUser(email string, password string) (User, error) {
-	log.Println("Creating a new user")
+// CreateChirp assigns an id and creation time to chirp and saves it to disk
+func (db *DB) CreateChirp(chirp Chirp) (Chirp, error) {
+	log.Println("Creating a new chirp")
 
-	// Check if email already exists
-	users, err := db.GetUsers()
-	if err != nil {
-		log.Println("Error getting users:", err)
-		return User{}, err
-	}
-	for _, user := range users {
-		if user.Email == email {
-			return User{}, errors.New("email already in use")
+	err := db.update(func(dbs *DBStructure) error {
+		if err := dbs.checkGroupPost(chirp); err != nil {
+			return err
 		}
+		chirp.Id = db.ChirpIdCounter
+		chirp.CreatedAt = time.Now().UTC()
+		db.ChirpIdCounter++
+		dbs.Chirps[chirp.Id] = chirp
+		return nil
+	})
+	if err != nil {
+		log.Println("Error writing database:", err)
+		return Chirp{}, err
 	}
+	log.Printf("Assigned chirp ID: %d", chirp.Id)
+	return chirp, nil
+}
 
-	// Hash the password
+// CreateUser creates a new user. handle is optional and may be empty.
+func (db *DB) CreateUser(email, password, handle string) (User, error) {
+	log.Println("Creating a new user")
+
+	// Hash the password before taking the lock, bcrypt is slow on purpose
 	hashPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
 		log.Println("Error hashing password:", err)
 		return User{}, err
 	}
 
-	// Create new user
-	user := User{
-		Id:       db.UserIdCounter,
-		Password: string(hashPassword),
-		Email:    email,
-	}
-	db.UserIdCounter++
-	log.Printf("Assigned user ID: %d", user.Id)
+	var user User
+	err = db.update(func(dbs *DBStructure) error {
+		// Check if email already exists
+		for _, existing := range dbs.Users {
+			if existing.Email == email {
+				return ErrEmailInUse
+			}
+		}
 
-	// Append new user and update database
-	users = append(users, user)
-	chirps, err := db.GetChirps()
-	if err != nil {
-		log.Println("Error getting chirps:", err)
-		return User{}, err
-	}
-	err = db.UpdateDB(users, chirps)
+		user = User{
+			Id:       db.UserIdCounter,
+			Password: string(hashPassword),
+			Email:    email,
+		}
+		if handle != "" {
+			if err := dbs.claimHandle(user.Id, handle, time.Now()); err != nil {
+				return err
+			}
+			user.Handle = handle
+		}
+		db.UserIdCounter++
+		dbs.Users[user.Id] = user
+		return nil
+	})
 	if err != nil {
-		log.Println("Error writing database:", err)
+		log.Println("Error creating user:", err)
 		return User{}, err
 	}
+	log.Printf("Assigned user ID: %d", user.Id)
 	log.Println("Successfully created a new user")
 	return user, nil
 }
 
 // GetChirps returns all chirps in the database
 func (db *DB) GetChirps() ([]Chirp, error) {
-	log.Println("Acquiring read lock for getting chirps")
-	db.Mux.RLock()
-	defer func() {
-		log.Println("Releasing read lock after getting chirps")
-		db.Mux.RUnlock()
-	}()
-
-	log.Println("Opening database file:", db.Path)
-	file, err := os.Open(db.Path)
-	if err != nil {
-		log.Println("Error opening database file:", err)
-		return nil, err
-	}
-	defer func() {
-		log.Println("Closing database file")
-		file.Close()
-	}()
-
-	log.Println("Checking if database file is empty")
-	fileInfo, err := file.Stat()
-	if err != nil {
-		log.Println("Error stating database file:", err)
-		return nil, err
-	}
-	if fileInfo.Size() == 0 {
-		log.Println("Database file is empty")
-		return []Chirp{}, nil
-	}
-
-	log.Println("Decoding database file")
-	decoder := json.NewDecoder(file)
-	var dbs DBStructure
-
-	err = decoder.Decode(&dbs)
+	dbs, err := db.readDB()
 	if err != nil {
-		log.Println("Error decoding database file:", err)
 		return nil, err
 	}
 
 	log.Println("Collecting chirps from decoded data")
-	var chirps []Chirp
+	chirps := make([]Chirp, 0, len(dbs.Chirps))
 	for _, chirp := range dbs.Chirps {
 		chirps = append(chirps, chirp)
 	}
@@ -188,96 +243,97 @@ func (db *DB) GetChirp(id int) (Chirp, error) {
 			return chirp, nil
 		}
 	}
-	return Chirp{}, errors.New("something happened")
+	return Chirp{}, ErrNotFound
 }
 
 func (db *DB) DeleteChirp(id int) error {
-	// Find the index of the chirp with the given ID
-	chirps, err := db.GetChirps()
-	if err != nil {
-		log.Println("Error happened when getting chirps", err)
-		return err
-
-	}
-	users, err := db.GetUsers()
-	if err != nil {
-		log.Println("Error happened when getting users", err)
-		return err
-
-	}
-
-	chirpIndex := -1
-	for i, chirp := range chirps {
-		if chirp.Id == id {
-			chirpIndex = i
-			break
+	err := db.update(func(dbs *DBStructure) error {
+		if _, ok := dbs.Chirps[id]; !ok {
+			return fmt.Errorf("chirp with ID %d not found", id)
 		}
+		dbs.removeChirp(id)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete chirp: %w", err)
 	}
-	if chirpIndex == -1 {
-		return fmt.Errorf("chirp with ID %d not found", id)
-	}
-
-	// Remove the chirp from the slice
-	chirps = append(chirps[:chirpIndex], chirps[chirpIndex+1:]...)
-
-	// Optionally, save the updated chirps back to the persistent storage if necessary
-	// This is dependent on your database implementation
-	errU := db.UpdateDB(users, chirps)
-	if errU != nil {
-		return fmt.Errorf("failed to update database: %v", err)
-	}
-
 	return nil
-
 }
 
-func (db *DB) GetUsers() ([]User, error) {
-	log.Println("Acquiring read lock for getting chirps")
-	db.Mux.RLock()
-	defer func() {
-		log.Println("Releasing read lock after getting chirps")
-		db.Mux.RUnlock()
-	}()
-
-	log.Println("Opening database file:", db.Path)
-	file, err := os.Open(db.Path)
+// DeleteChirps deletes the given chirps in a single write and returns the ones
+// that still existed
+func (db *DB) DeleteChirps(ids []int) ([]Chirp, error) {
+	var deleted []Chirp
+	err := db.update(func(dbs *DBStructure) error {
+		for _, id := range ids {
+			chirp, ok := dbs.Chirps[id]
+			if !ok {
+				continue
+			}
+			dbs.removeChirp(id)
+			deleted = append(deleted, chirp)
+		}
+		return nil
+	})
 	if err != nil {
-		log.Println("Error opening database file:", err)
 		return nil, err
 	}
-	defer func() {
-		log.Println("Closing database file")
-		file.Close()
-	}()
+	return deleted, nil
+}
 
-	log.Println("Checking if database file is empty")
-	fileInfo, err := file.Stat()
+// GetExpiredChirpIds returns the ids of ephemeral chirps that expired by now
+func (db *DB) GetExpiredChirpIds(now time.Time) ([]int, error) {
+	dbs, err := db.readDB()
 	if err != nil {
-		log.Println("Error stating database file:", err)
 		return nil, err
 	}
-	if fileInfo.Size() == 0 {
-		log.Println("Database file is empty")
-		return []User{}, nil
+
+	var ids []int
+	for id, chirp := range dbs.Chirps {
+		if chirp.IsExpired(now) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
+
+// removeChirp deletes a chirp together with everything that refers to it
+func (dbs *DBStructure) removeChirp(id int) {
+	delete(dbs.Chirps, id)
+	delete(dbs.PollVotes, id)
+	for _, bookmarks := range dbs.Bookmarks {
+		delete(bookmarks, id)
 	}
+	for userId, pinned := range dbs.PinnedChirps {
+		dbs.PinnedChirps[userId] = removeId(pinned, id)
+	}
+}
 
-	log.Println("Decoding database file")
-	decoder := json.NewDecoder(file)
-	var dbs DBStructure
+// removeId returns ids without id
+func removeId(ids []int, id int) []int {
+	kept := ids[:0]
+	for _, existing := range ids {
+		if existing != id {
+			kept = append(kept, existing)
+		}
+	}
+	return kept
+}
 
-	err = decoder.Decode(&dbs)
+func (db *DB) GetUsers() ([]User, error) {
+	dbs, err := db.readDB()
 	if err != nil {
-		log.Println("Error decoding database file:", err)
 		return nil, err
 	}
 
 	log.Println("Collecting users from decoded data")
-	var users []User
+	users := make([]User, 0, len(dbs.Users))
 	for _, user := range dbs.Users {
 		users = append(users, user)
 	}
 
-	log.Println("Sorting ysers by ID")
+	log.Println("Sorting users by ID")
 	sort.Slice(users, func(i, j int) bool { return users[i].Id < users[j].Id })
 	return users, nil
 }
@@ -309,44 +365,35 @@ func (db *DB) GetUser(email, password string) (User, error) {
 	return User{}, errors.New("no user was found for this email")
 }
 
-func (db *DB) UpdateUser(id int, newEmail, newPassword, refresh_token string) error {
-
-	users, errU := db.GetUsers()
-	if errU != nil {
-		return errU
-	}
-	chirps, errC := db.GetChirps()
-	if errC != nil {
-		return errC
+// UpdateUser sets the email and password of the user with id, leaving the
+// rest of the database untouched. It returns ErrEmailInUse if another user
+// has newEmail.
+func (db *DB) UpdateUser(id int, newEmail, newPassword string) error {
+	// Hash the password before taking the lock, bcrypt is slow on purpose
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return err
 	}
 
-	userUpdated := false
-	for i := range users {
-		if users[i].Id == id {
-			users[i].Email = newEmail
-
-			// Hash new password
-			hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
-			if err != nil {
-				return err
+	return db.update(func(dbs *DBStructure) error {
+		user, ok := dbs.Users[id]
+		if !ok {
+			return ErrNotFound
+		}
+		if user.Email != newEmail {
+			for _, existing := range dbs.Users {
+				if existing.Id != id && existing.Email == newEmail {
+					return ErrEmailInUse
+				}
 			}
-			users[i].Password = string(hashedPassword)
-			users[i].RefreshToken = refresh_token
-			refreshExpirationDate := time.Now().Add(60 * 24 * time.Hour) // 60 days from now
-			users[i].RefreshExpirationDate = refreshExpirationDate
-			userUpdated = true
-			break
+			// The new address has not been verified yet
+			user.Verified = false
 		}
-	}
-
-	if !userUpdated {
-		return fmt.Errorf("user with ID %d not found", id)
-	}
-
-	// Save updated users and chirps back to the database
-	db.UpdateDB(users, chirps)
-
-	return nil
+		user.Email = newEmail
+		user.Password = string(hashedPassword)
+		dbs.Users[id] = user
+		return nil
+	})
 }
 
 // ensureDB creates a new database file if it doesn't exist
@@ -377,7 +424,165 @@ func (db *DB) ensureDB() error {
 	return nil
 }
 
-// writeDB writes the database file to disk
+// readDB loads the whole database file while holding the read lock
+func (db *DB) readDB() (DBStructure, error) {
+	db.Mux.RLock()
+	defer db.Mux.RUnlock()
+	return db.loadDB()
+}
+
+// update loads the database, applies fn to it and writes the result back
+// while holding the write lock, so the read-modify-write is atomic. Nothing is
+// written if fn returns an error.
+func (db *DB) update(fn func(dbs *DBStructure) error) error {
+	log.Println("Acquiring write lock for updating the database")
+	db.Mux.Lock()
+	defer func() {
+		log.Println("Releasing write lock after updating the database")
+		db.Mux.Unlock()
+	}()
+
+	dbs, err := db.loadDB()
+	if err != nil {
+		return err
+	}
+	if err := fn(&dbs); err != nil {
+		return err
+	}
+	return db.writeDB(dbs)
+}
+
+// loadDB decodes the database file. The caller must hold Mux.
+func (db *DB) loadDB() (DBStructure, error) {
+	log.Println("Opening database file:", db.Path)
+	data, err := os.ReadFile(db.Path)
+	if err != nil {
+		log.Println("Error opening database file:", err)
+		return DBStructure{}, err
+	}
+
+	var dbs DBStructure
+	if len(data) > 0 {
+		log.Println("Decoding database file")
+		if err := json.Unmarshal(data, &dbs); err != nil {
+			log.Println("Error decoding database file:", err)
+			return DBStructure{}, err
+		}
+	}
+	dbs.ensureTables()
+
+	now := time.Now()
+	for _, chirp := range dbs.Chirps {
+		if chirp.Poll != nil {
+			chirp.Poll.Closed = chirp.Poll.IsClosed(now)
+		}
+	}
+	return dbs, nil
+}
+
+// ensureTables allocates any table missing from an older or empty file
+func (dbs *DBStructure) ensureTables() {
+	if dbs.Chirps == nil {
+		dbs.Chirps = make(map[int]Chirp)
+	}
+	if dbs.Users == nil {
+		dbs.Users = make(map[int]User)
+	}
+	if dbs.ScheduledChirps == nil {
+		dbs.ScheduledChirps = make(map[int]ScheduledChirp)
+	}
+	if dbs.Drafts == nil {
+		dbs.Drafts = make(map[int]Draft)
+	}
+	if dbs.PollVotes == nil {
+		dbs.PollVotes = make(map[int]map[int]int)
+	}
+	if dbs.Bookmarks == nil {
+		dbs.Bookmarks = make(map[int]map[int]time.Time)
+	}
+	if dbs.PinnedChirps == nil {
+		dbs.PinnedChirps = make(map[int][]int)
+	}
+	if dbs.Following == nil {
+		dbs.Following = make(map[int]map[int]time.Time)
+	}
+	if dbs.Followers == nil {
+		dbs.Followers = make(map[int]map[int]time.Time)
+	}
+	if dbs.Inboxes == nil {
+		dbs.Inboxes = make(map[int][]int)
+	}
+	if dbs.Blocks == nil {
+		dbs.Blocks = make(map[int]map[int]time.Time)
+	}
+	if dbs.Mutes == nil {
+		dbs.Mutes = make(map[int]map[int]time.Time)
+	}
+	if dbs.Handles == nil {
+		dbs.Handles = make(map[string]int)
+	}
+	if dbs.ReservedHandles == nil {
+		dbs.ReservedHandles = make(map[string]HandleReservation)
+	}
+	if dbs.Conversations == nil {
+		dbs.Conversations = make(map[int]Conversation)
+	}
+	if dbs.Messages == nil {
+		dbs.Messages = make(map[int][]Message)
+	}
+	if dbs.Notifications == nil {
+		dbs.Notifications = make(map[int]Notification)
+	}
+	if dbs.Lists == nil {
+		dbs.Lists = make(map[int]List)
+	}
+	if dbs.Groups == nil {
+		dbs.Groups = make(map[int]Group)
+	}
+	if dbs.GroupMembers == nil {
+		dbs.GroupMembers = make(map[int]map[int]GroupMember)
+	}
+	if dbs.Sessions == nil {
+		dbs.Sessions = make(map[int]Session)
+	}
+	if dbs.SessionsByToken == nil {
+		dbs.SessionsByToken = make(map[string]int)
+	}
+	if dbs.RetiredTokens == nil {
+		dbs.RetiredTokens = make(map[string]RetiredToken)
+	}
+	if dbs.SecurityEvents == nil {
+		dbs.SecurityEvents = make(map[int]SecurityEvent)
+	}
+	if dbs.RevokedAccessTokens == nil {
+		dbs.RevokedAccessTokens = make(map[string]time.Time)
+	}
+	if dbs.PasswordResets == nil {
+		dbs.PasswordResets = make(map[string]PasswordReset)
+	}
+	if dbs.EmailVerifications == nil {
+		dbs.EmailVerifications = make(map[string]EmailVerification)
+	}
+	if dbs.TwoFactor == nil {
+		dbs.TwoFactor = make(map[int]TwoFactor)
+	}
+	if dbs.MFAChallenges == nil {
+		dbs.MFAChallenges = make(map[string]MFAChallenge)
+	}
+}
+
+// nextId returns the id following the largest one used in table
+func nextId[T any](table map[int]T) int {
+	next := 1
+	for id := range table {
+		if id >= next {
+			next = id + 1
+		}
+	}
+	return next
+}
+
+// writeDB writes the database file to disk. The caller must hold the write lock.
 func (db *DB) writeDB(dbStructure DBStructure) error {
 	log.Println("Ensuring database file exists")
 	err := db.ensureDB()
@@ -393,13 +598,6 @@ func (db *DB) writeDB(dbStructure DBStructure) error {
 		return errD
 	}
 
-	log.Println("Acquiring write lock for writing to the database")
-	db.Mux.Lock()
-	defer func() {
-		log.Println("Releasing write lock after writing to the database")
-		db.Mux.Unlock()
-	}()
-
 	log.Println("Writing data to database file:", db.Path)
 	errW := os.WriteFile(db.Path, data, 0644)
 	if errW != nil {
@@ -411,16 +609,17 @@ func (db *DB) writeDB(dbStructure DBStructure) error {
 	return nil
 }
 
+// UpdateDB replaces the users and chirps tables, leaving the others untouched
 func (db *DB) UpdateDB(users []User, chirps []Chirp) error {
-	dbs := DBStructure{
-		Users:  make(map[int]User),
-		Chirps: make(map[int]Chirp),
-	}
-	for _, u := range users {
-		dbs.Users[u.Id] = u
-	}
-	for _, c := range chirps {
-		dbs.Chirps[c.Id] = c
-	}
-	return db.writeDB(dbs)
+	return db.update(func(dbs *DBStructure) error {
+		dbs.Users = make(map[int]User)
+		dbs.Chirps = make(map[int]Chirp)
+		for _, u := range users {
+			dbs.Users[u.Id] = u
+		}
+		for _, c := range chirps {
+			dbs.Chirps[c.Id] = c
+		}
+		return nil
+	})
 }
@@ -0,0 +1,118 @@
+package database
+
+import (
+	"log"
+	"sort"
+	"time"
+
+	. "github.com/mohamed2394/goserver/internal"
+)
+
+// CreateDraft saves a new draft for authorId
+func (db *DB) CreateDraft(authorId int, body, visibility string) (Draft, error) {
+	var draft Draft
+	err := db.update(func(dbs *DBStructure) error {
+		now := time.Now().UTC()
+		draft = Draft{
+			Id:         nextId(dbs.Drafts),
+			Body:       body,
+			AuthorId:   authorId,
+			Visibility: visibility,
+			CreatedAt:  now,
+			UpdatedAt:  now,
+		}
+		dbs.Drafts[draft.Id] = draft
+		return nil
+	})
+	if err != nil {
+		log.Println("Error writing database:", err)
+		return Draft{}, err
+	}
+	return draft, nil
+}
+
+// GetDrafts returns the drafts of an author, most recently edited first
+func (db *DB) GetDrafts(authorId int) ([]Draft, error) {
+	dbs, err := db.readDB()
+	if err != nil {
+		return nil, err
+	}
+
+	drafts := []Draft{}
+	for _, draft := range dbs.Drafts {
+		if draft.AuthorId == authorId {
+			drafts = append(drafts, draft)
+		}
+	}
+	sort.Slice(drafts, func(i, j int) bool {
+		if drafts[i].UpdatedAt.Equal(drafts[j].UpdatedAt) {
+			return drafts[i].Id > drafts[j].Id
+		}
+		return drafts[i].UpdatedAt.After(drafts[j].UpdatedAt)
+	})
+	return drafts, nil
+}
+
+// UpdateDraft replaces the contents of a draft owned by authorId
+func (db *DB) UpdateDraft(id, authorId int, body, visibility string) (Draft, error) {
+	var draft Draft
+	err := db.update(func(dbs *DBStructure) error {
+		existing, ok := dbs.Drafts[id]
+		if !ok || existing.AuthorId != authorId {
+			return ErrNotFound
+		}
+		existing.Body = body
+		existing.Visibility = visibility
+		existing.UpdatedAt = time.Now().UTC()
+		dbs.Drafts[id] = existing
+		draft = existing
+		return nil
+	})
+	return draft, err
+}
+
+// DeleteDraft removes a draft owned by authorId
+func (db *DB) DeleteDraft(id, authorId int) error {
+	return db.update(func(dbs *DBStructure) error {
+		draft, ok := dbs.Drafts[id]
+		if !ok || draft.AuthorId != authorId {
+			return ErrNotFound
+		}
+		delete(dbs.Drafts, id)
+		return nil
+	})
+}
+
+// PublishDraft turns a draft into a chirp and removes the draft in a single
+// write. prepare receives the draft body and returns the body to publish; if
+// it fails nothing is changed.
+func (db *DB) PublishDraft(id, authorId int, prepare func(body string) (string, error)) (Chirp, error) {
+	var chirp Chirp
+	err := db.update(func(dbs *DBStructure) error {
+		draft, ok := dbs.Drafts[id]
+		if !ok || draft.AuthorId != authorId {
+			return ErrNotFound
+		}
+		body, err := prepare(draft.Body)
+		if err != nil {
+			return err
+		}
+
+		chirp = Chirp{
+			Id:         db.ChirpIdCounter,
+			Body:       body,
+			AuthorId:   authorId,
+			Visibility: draft.Visibility,
+			CreatedAt:  time.Now().UTC(),
+		}
+		db.ChirpIdCounter++
+		delete(dbs.Drafts, id)
+		dbs.Chirps[chirp.Id] = chirp
+		return nil
+	})
+	if err != nil {
+		return Chirp{}, err
+	}
+	log.Printf("Published draft %d as chirp with ID: %d", id, chirp.Id)
+	return chirp, nil
+}
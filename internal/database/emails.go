@@ -0,0 +1,164 @@
+package database
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	. "github.com/mohamed2394/goserver/internal"
+)
+
+// GetUserById returns the user with id
+func (db *DB) GetUserById(id int) (User, error) {
+	dbs, err := db.readDB()
+	if err != nil {
+		return User{}, err
+	}
+	user, ok := dbs.Users[id]
+	if !ok {
+		return User{}, ErrNotFound
+	}
+	return user, nil
+}
+
+// CreateEmailVerification stores token as the verification of the current
+// email of userId, valid until now+ttl, and returns the user. Any earlier
+// verification of the user stops working.
+func (db *DB) CreateEmailVerification(userId int, token string, now time.Time, ttl time.Duration) (User, error) {
+	var user User
+	err := db.update(func(dbs *DBStructure) error {
+		var ok bool
+		user, ok = dbs.Users[userId]
+		if !ok {
+			return ErrNotFound
+		}
+
+		for hash, v := range dbs.EmailVerifications {
+			if v.UserId == userId || !now.Before(v.ExpiresAt) {
+				delete(dbs.EmailVerifications, hash)
+			}
+		}
+		dbs.EmailVerifications[hashToken(token)] = EmailVerification{
+			UserId:    userId,
+			Email:     user.Email,
+			CreatedAt: now.UTC(),
+			ExpiresAt: now.Add(ttl).UTC(),
+		}
+		return nil
+	})
+	return user, err
+}
+
+// VerifyEmail marks the email the verification token was sent to as
+// verified and returns its user. The token cannot be used again. It returns
+// ErrNotFound if the token is unknown, used or expired, or if the user has
+// changed their email since it was sent.
+func (db *DB) VerifyEmail(token string, now time.Time) (User, error) {
+	var user User
+	verified := false
+	err := db.update(func(dbs *DBStructure) error {
+		hash := hashToken(token)
+		v, ok := dbs.EmailVerifications[hash]
+		if !ok {
+			return ErrNotFound
+		}
+		// Dropped even when unusable, so the outcome is reported after the update
+		delete(dbs.EmailVerifications, hash)
+
+		user, ok = dbs.Users[v.UserId]
+		if !ok || user.Email != v.Email || !now.Before(v.ExpiresAt) {
+			return nil
+		}
+		user.Verified = true
+		dbs.Users[user.Id] = user
+		verified = true
+		return nil
+	})
+	if err != nil {
+		return User{}, err
+	}
+	if !verified {
+		return User{}, ErrNotFound
+	}
+	return user, nil
+}
+
+// migrateUsers brings user records written before emails were normalized and
+// verified in line with the current rules. Users whose record has no
+// verified field at all predate verification and are marked as such.
+func (db *DB) migrateUsers() error {
+	data, err := os.ReadFile(db.Path)
+	if err != nil {
+		return err
+	}
+	var raw struct {
+		Users map[int]map[string]json.RawMessage `json:"users"`
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return err
+		}
+	}
+
+	return db.update(func(dbs *DBStructure) error {
+		for id, fields := range raw.Users {
+			if _, ok := fields["verified"]; ok {
+				continue
+			}
+			if user, ok := dbs.Users[id]; ok {
+				user.PredatesVerification = true
+				dbs.Users[id] = user
+			}
+		}
+		dbs.normalizeEmails()
+		return nil
+	})
+}
+
+// normalizeEmails rewrites stored emails in normalized form, so lookups by a
+// normalized address find them. When several users share an address once
+// normalized, a user already holding it exactly keeps it, then a verified
+// user, then the oldest account. The others, and addresses that are not
+// valid, are left as they are and logged for an administrator to resolve.
+func (dbs *DBStructure) normalizeEmails() {
+	claims := make(map[string][]User)
+	for _, user := range dbs.Users {
+		normalized, err := NormalizeEmail(user.Email)
+		if err != nil {
+			log.Printf("User %d has an invalid email address, leaving it as is", user.Id)
+			continue
+		}
+		claims[normalized] = append(claims[normalized], user)
+	}
+
+	for email, users := range claims {
+		sort.Slice(users, func(i, j int) bool {
+			a, b := users[i], users[j]
+			if (a.Email == email) != (b.Email == email) {
+				return a.Email == email
+			}
+			if a.Verified != b.Verified {
+				return a.Verified
+			}
+			return a.Id < b.Id
+		})
+
+		owner := users[0]
+		if owner.Email != email {
+			for hash, v := range dbs.EmailVerifications {
+				if v.UserId == owner.Id && v.Email == owner.Email {
+					v.Email = email
+					dbs.EmailVerifications[hash] = v
+				}
+			}
+			owner.Email = email
+			dbs.Users[owner.Id] = owner
+		}
+		for _, other := range users[1:] {
+			log.Printf("User %d's email %q collides with user %d's %q, leaving it as is",
+				other.Id, other.Email, owner.Id, email)
+		}
+	}
+}
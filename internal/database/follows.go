@@ -0,0 +1,104 @@
+package database
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	. "github.com/mohamed2394/goserver/internal"
+)
+
+var (
+	ErrSelfFollow = errors.New("users can't follow themselves")
+	ErrBlocked    = errors.New("one of the users has blocked the other")
+)
+
+// Follow makes followerId follow followeeId. Following twice is a no-op;
+// created reports whether a new edge was added.
+func (db *DB) Follow(followerId, followeeId int) (created bool, err error) {
+	if followerId == followeeId {
+		return false, ErrSelfFollow
+	}
+	err = db.update(func(dbs *DBStructure) error {
+		if _, ok := dbs.Users[followeeId]; !ok {
+			return ErrNotFound
+		}
+		if dbs.isBlocked(followerId, followeeId) {
+			return ErrBlocked
+		}
+		if _, ok := dbs.Following[followerId][followeeId]; ok {
+			return nil
+		}
+		dbs.addFollow(followerId, followeeId, time.Now().UTC())
+		created = true
+		return nil
+	})
+	return created, err
+}
+
+// Unfollow removes the follow edge from followerId to followeeId
+func (db *DB) Unfollow(followerId, followeeId int) error {
+	return db.update(func(dbs *DBStructure) error {
+		if _, ok := dbs.Following[followerId][followeeId]; !ok {
+			return ErrNotFound
+		}
+		dbs.removeFollow(followerId, followeeId)
+		return nil
+	})
+}
+
+// GetFollowers returns the users following userId, most recent first
+func (db *DB) GetFollowers(userId int) ([]Follow, error) {
+	dbs, err := db.readDB()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := dbs.Users[userId]; !ok {
+		return nil, ErrNotFound
+	}
+	return sortedFollows(dbs.Followers[userId]), nil
+}
+
+// GetFollowing returns the users userId follows, most recent first
+func (db *DB) GetFollowing(userId int) ([]Follow, error) {
+	dbs, err := db.readDB()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := dbs.Users[userId]; !ok {
+		return nil, ErrNotFound
+	}
+	return sortedFollows(dbs.Following[userId]), nil
+}
+
+// addFollow records a follow edge in both indexes
+func (dbs *DBStructure) addFollow(followerId, followeeId int, since time.Time) {
+	if dbs.Following[followerId] == nil {
+		dbs.Following[followerId] = make(map[int]time.Time)
+	}
+	if dbs.Followers[followeeId] == nil {
+		dbs.Followers[followeeId] = make(map[int]time.Time)
+	}
+	dbs.Following[followerId][followeeId] = since
+	dbs.Followers[followeeId][followerId] = since
+}
+
+// removeFollow deletes a follow edge from both indexes
+func (dbs *DBStructure) removeFollow(followerId, followeeId int) {
+	delete(dbs.Following[followerId], followeeId)
+	delete(dbs.Followers[followeeId], followerId)
+}
+
+func sortedFollows(edges map[int]time.Time) []Follow {
+	follows := make([]Follow, 0, len(edges))
+	for userId, since := range edges {
+		follows = append(follows, Follow{UserId: userId, CreatedAt: since})
+	}
+	sort.Slice(follows, func(i, j int) bool {
+		if follows[i].CreatedAt.Equal(follows[j].CreatedAt) {
+			return follows[i].UserId > follows[j].UserId
+		}
+		return follows[i].CreatedAt.After(follows[j].CreatedAt)
+	})
+	return follows
+}
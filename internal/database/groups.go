@@ -0,0 +1,228 @@
+package database
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	. "github.com/mohamed2394/goserver/internal"
+)
+
+var (
+	ErrNotGroupMember = errors.New("user is not a member of the group")
+	ErrGroupOwner     = errors.New("the group owner can't leave or be removed")
+	ErrNotPermitted   = errors.New("not permitted by the user's group role")
+)
+
+// groupRoleRank orders roles from least to most privileged
+var groupRoleRank = map[string]int{
+	GroupRoleMember:    0,
+	GroupRoleModerator: 1,
+	GroupRoleOwner:     2,
+}
+
+// CreateGroup stores a new group with ownerId as its owner and first member
+func (db *DB) CreateGroup(ownerId int, name, description string) (Group, error) {
+	var group Group
+	err := db.update(func(dbs *DBStructure) error {
+		now := time.Now().UTC()
+		group = Group{
+			Id:          nextId(dbs.Groups),
+			Name:        name,
+			Description: description,
+			OwnerId:     ownerId,
+			CreatedAt:   now,
+		}
+		dbs.Groups[group.Id] = group
+		dbs.GroupMembers[group.Id] = map[int]GroupMember{
+			ownerId: {UserId: ownerId, Role: GroupRoleOwner, JoinedAt: now},
+		}
+		group.MemberCount = 1
+		return nil
+	})
+	return group, err
+}
+
+// GetGroups returns every group, newest first
+func (db *DB) GetGroups() ([]Group, error) {
+	dbs, err := db.readDB()
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make([]Group, 0, len(dbs.Groups))
+	for _, group := range dbs.Groups {
+		groups = append(groups, dbs.group(group))
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Id > groups[j].Id })
+	return groups, nil
+}
+
+// GetGroup returns a group
+func (db *DB) GetGroup(id int) (Group, error) {
+	dbs, err := db.readDB()
+	if err != nil {
+		return Group{}, err
+	}
+	group, ok := dbs.Groups[id]
+	if !ok {
+		return Group{}, ErrNotFound
+	}
+	return dbs.group(group), nil
+}
+
+// JoinGroup adds userId to a group as a member. Joining twice is a no-op.
+func (db *DB) JoinGroup(id, userId int) (GroupMember, error) {
+	var member GroupMember
+	err := db.update(func(dbs *DBStructure) error {
+		members, ok := dbs.GroupMembers[id]
+		if !ok {
+			return ErrNotFound
+		}
+		if existing, ok := members[userId]; ok {
+			member = existing
+			return nil
+		}
+		member = GroupMember{UserId: userId, Role: GroupRoleMember, JoinedAt: time.Now().UTC()}
+		members[userId] = member
+		return nil
+	})
+	return member, err
+}
+
+// RemoveGroupMember removes userId from a group on behalf of actorId. Members
+// may leave on their own; removing someone else takes a role above theirs.
+// The owner can't be removed.
+func (db *DB) RemoveGroupMember(id, actorId, userId int) error {
+	return db.update(func(dbs *DBStructure) error {
+		members, ok := dbs.GroupMembers[id]
+		if !ok {
+			return ErrNotFound
+		}
+		member, ok := members[userId]
+		if !ok {
+			return ErrNotGroupMember
+		}
+		if member.Role == GroupRoleOwner {
+			return ErrGroupOwner
+		}
+		if actorId != userId {
+			actor, ok := members[actorId]
+			if !ok || !actor.CanModerate() || groupRoleRank[actor.Role] <= groupRoleRank[member.Role] {
+				return ErrNotPermitted
+			}
+		}
+		delete(members, userId)
+		return nil
+	})
+}
+
+// SetGroupRole makes userId a moderator or plain member. Only the owner may
+// change roles, and the owner's own role can't be changed.
+func (db *DB) SetGroupRole(id, actorId, userId int, role string) (GroupMember, error) {
+	var member GroupMember
+	err := db.update(func(dbs *DBStructure) error {
+		group, ok := dbs.Groups[id]
+		if !ok {
+			return ErrNotFound
+		}
+		if group.OwnerId != actorId {
+			return ErrNotPermitted
+		}
+		member, ok = dbs.GroupMembers[id][userId]
+		if !ok {
+			return ErrNotGroupMember
+		}
+		if member.Role == GroupRoleOwner {
+			return ErrGroupOwner
+		}
+		member.Role = role
+		dbs.GroupMembers[id][userId] = member
+		return nil
+	})
+	return member, err
+}
+
+// GetGroupMember returns the membership of userId in a group
+func (db *DB) GetGroupMember(id, userId int) (GroupMember, error) {
+	dbs, err := db.readDB()
+	if err != nil {
+		return GroupMember{}, err
+	}
+	members, ok := dbs.GroupMembers[id]
+	if !ok {
+		return GroupMember{}, ErrNotFound
+	}
+	member, ok := members[userId]
+	if !ok {
+		return GroupMember{}, ErrNotGroupMember
+	}
+	return member, nil
+}
+
+// GetGroupMembers returns the members of a group, owner and moderators
+// first, then in the order they joined
+func (db *DB) GetGroupMembers(id int) ([]GroupMember, error) {
+	dbs, err := db.readDB()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := dbs.Groups[id]; !ok {
+		return nil, ErrNotFound
+	}
+
+	members := make([]GroupMember, 0, len(dbs.GroupMembers[id]))
+	for _, member := range dbs.GroupMembers[id] {
+		members = append(members, member)
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if members[i].Role != members[j].Role {
+			return groupRoleRank[members[i].Role] > groupRoleRank[members[j].Role]
+		}
+		if members[i].JoinedAt.Equal(members[j].JoinedAt) {
+			return members[i].UserId < members[j].UserId
+		}
+		return members[i].JoinedAt.Before(members[j].JoinedAt)
+	})
+	return members, nil
+}
+
+// GetGroupChirps returns the chirps posted into a group, newest first
+func (db *DB) GetGroupChirps(id int) ([]Chirp, error) {
+	dbs, err := db.readDB()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := dbs.Groups[id]; !ok {
+		return nil, ErrNotFound
+	}
+
+	chirps := []Chirp{}
+	for _, chirp := range dbs.Chirps {
+		if chirp.GroupId == id {
+			chirps = append(chirps, chirp)
+		}
+	}
+	sort.Slice(chirps, func(i, j int) bool { return chirps[i].Id > chirps[j].Id })
+	return chirps, nil
+}
+
+// checkGroupPost makes sure the author of a group chirp belongs to the group
+func (dbs *DBStructure) checkGroupPost(chirp Chirp) error {
+	if chirp.GroupId == 0 {
+		return nil
+	}
+	members, ok := dbs.GroupMembers[chirp.GroupId]
+	if !ok {
+		return ErrNotFound
+	}
+	if _, ok := members[chirp.AuthorId]; !ok {
+		return ErrNotGroupMember
+	}
+	return nil
+}
+
+func (dbs *DBStructure) group(group Group) Group {
+	group.MemberCount = len(dbs.GroupMembers[group.Id])
+	return group
+}
@@ -0,0 +1,175 @@
+package database
+
+import (
+	"errors"
+	"slices"
+	"sort"
+	"time"
+
+	. "github.com/mohamed2394/goserver/internal"
+)
+
+var ErrUnknownUser = errors.New("user does not exist")
+
+// CreateList stores a new, empty list owned by ownerId
+func (db *DB) CreateList(ownerId int, name string, private bool) (List, error) {
+	var list List
+	err := db.update(func(dbs *DBStructure) error {
+		list = List{
+			Id:        nextId(dbs.Lists),
+			OwnerId:   ownerId,
+			Name:      name,
+			Private:   private,
+			MemberIds: []int{},
+			CreatedAt: time.Now().UTC(),
+		}
+		dbs.Lists[list.Id] = list
+		return nil
+	})
+	return list, err
+}
+
+// GetLists returns the lists owned by ownerId, newest first. Private lists are
+// only included when viewerId is the owner.
+func (db *DB) GetLists(ownerId, viewerId int) ([]List, error) {
+	dbs, err := db.readDB()
+	if err != nil {
+		return nil, err
+	}
+
+	lists := []List{}
+	for _, list := range dbs.Lists {
+		if list.OwnerId == ownerId && list.VisibleTo(viewerId) {
+			lists = append(lists, list)
+		}
+	}
+	sort.Slice(lists, func(i, j int) bool { return lists[i].Id > lists[j].Id })
+	return lists, nil
+}
+
+// GetList returns a list, or ErrNotFound if it is private and viewerId is not its owner
+func (db *DB) GetList(id, viewerId int) (List, error) {
+	dbs, err := db.readDB()
+	if err != nil {
+		return List{}, err
+	}
+	list, ok := dbs.Lists[id]
+	if !ok || !list.VisibleTo(viewerId) {
+		return List{}, ErrNotFound
+	}
+	return list, nil
+}
+
+// UpdateList renames a list owned by ownerId and sets its privacy
+func (db *DB) UpdateList(id, ownerId int, name string, private bool) (List, error) {
+	var list List
+	err := db.update(func(dbs *DBStructure) error {
+		var ok bool
+		list, ok = dbs.Lists[id]
+		if !ok || list.OwnerId != ownerId {
+			return ErrNotFound
+		}
+		list.Name = name
+		list.Private = private
+		dbs.Lists[id] = list
+		return nil
+	})
+	return list, err
+}
+
+// DeleteList deletes a list owned by ownerId
+func (db *DB) DeleteList(id, ownerId int) error {
+	return db.update(func(dbs *DBStructure) error {
+		list, ok := dbs.Lists[id]
+		if !ok || list.OwnerId != ownerId {
+			return ErrNotFound
+		}
+		delete(dbs.Lists, id)
+		return nil
+	})
+}
+
+// AddListMember adds userId to a list owned by ownerId. Adding a member twice
+// is a no-op. Users on either side of a block with the owner can't be added.
+func (db *DB) AddListMember(id, ownerId, userId int) (List, error) {
+	var list List
+	err := db.update(func(dbs *DBStructure) error {
+		var ok bool
+		list, ok = dbs.Lists[id]
+		if !ok || list.OwnerId != ownerId {
+			return ErrNotFound
+		}
+		if _, ok := dbs.Users[userId]; !ok {
+			return ErrUnknownUser
+		}
+		if dbs.isBlocked(ownerId, userId) {
+			return ErrBlocked
+		}
+		if slices.Contains(list.MemberIds, userId) {
+			return nil
+		}
+		list.MemberIds = append(list.MemberIds, userId)
+		dbs.Lists[id] = list
+		return nil
+	})
+	return list, err
+}
+
+// RemoveListMember removes userId from a list owned by ownerId
+func (db *DB) RemoveListMember(id, ownerId, userId int) (List, error) {
+	var list List
+	err := db.update(func(dbs *DBStructure) error {
+		var ok bool
+		list, ok = dbs.Lists[id]
+		if !ok || list.OwnerId != ownerId {
+			return ErrNotFound
+		}
+		if !slices.Contains(list.MemberIds, userId) {
+			return ErrUnknownUser
+		}
+		list.MemberIds = removeId(list.MemberIds, userId)
+		dbs.Lists[id] = list
+		return nil
+	})
+	return list, err
+}
+
+// GetListChirps returns the chirps posted by the members of a list, newest
+// first, or ErrNotFound if viewerId may not see the list
+func (db *DB) GetListChirps(id, viewerId int) ([]Chirp, error) {
+	dbs, err := db.readDB()
+	if err != nil {
+		return nil, err
+	}
+	list, ok := dbs.Lists[id]
+	if !ok || !list.VisibleTo(viewerId) {
+		return nil, ErrNotFound
+	}
+
+	members := make(map[int]bool, len(list.MemberIds))
+	for _, memberId := range list.MemberIds {
+		members[memberId] = true
+	}
+
+	chirps := []Chirp{}
+	for _, chirp := range dbs.Chirps {
+		if members[chirp.AuthorId] {
+			chirps = append(chirps, chirp)
+		}
+	}
+	sort.Slice(chirps, func(i, j int) bool { return chirps[i].Id > chirps[j].Id })
+	return chirps, nil
+}
+
+// removeFromLists drops userId from every list owned by ownerId
+func (dbs *DBStructure) removeFromLists(ownerId, userId int) {
+	for id, list := range dbs.Lists {
+		if list.OwnerId != ownerId {
+			continue
+		}
+		if slices.Contains(list.MemberIds, userId) {
+			list.MemberIds = removeId(list.MemberIds, userId)
+			dbs.Lists[id] = list
+		}
+	}
+}
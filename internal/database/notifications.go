@@ -0,0 +1,104 @@
+package database
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	. "github.com/mohamed2394/goserver/internal"
+)
+
+// CreateNotifications stores notifications in a single write
+func (db *DB) CreateNotifications(notifications []Notification) error {
+	if len(notifications) == 0 {
+		return nil
+	}
+	return db.update(func(dbs *DBStructure) error {
+		now := time.Now().UTC()
+		for _, notification := range notifications {
+			notification.Id = nextId(dbs.Notifications)
+			notification.Read = false
+			notification.CreatedAt = now
+			dbs.Notifications[notification.Id] = notification
+		}
+		return nil
+	})
+}
+
+// GetNotifications returns the notifications of userId, newest first
+func (db *DB) GetNotifications(userId int, unreadOnly bool) ([]Notification, error) {
+	dbs, err := db.readDB()
+	if err != nil {
+		return nil, err
+	}
+
+	notifications := []Notification{}
+	for _, notification := range dbs.Notifications {
+		if notification.UserId == userId && !(unreadOnly && notification.Read) {
+			notifications = append(notifications, notification)
+		}
+	}
+	sort.Slice(notifications, func(i, j int) bool { return notifications[i].Id > notifications[j].Id })
+	return notifications, nil
+}
+
+// GetUnreadNotificationCount returns how many notifications of userId are unread
+func (db *DB) GetUnreadNotificationCount(userId int) (int, error) {
+	dbs, err := db.readDB()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, notification := range dbs.Notifications {
+		if notification.UserId == userId && !notification.Read {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// MarkNotificationRead marks one of userId's notifications as read
+func (db *DB) MarkNotificationRead(id, userId int) error {
+	return db.update(func(dbs *DBStructure) error {
+		notification, ok := dbs.Notifications[id]
+		if !ok || notification.UserId != userId {
+			return ErrNotFound
+		}
+		notification.Read = true
+		dbs.Notifications[id] = notification
+		return nil
+	})
+}
+
+// MarkAllNotificationsRead marks every notification of userId as read
+func (db *DB) MarkAllNotificationsRead(userId int) error {
+	return db.update(func(dbs *DBStructure) error {
+		for id, notification := range dbs.Notifications {
+			if notification.UserId == userId && !notification.Read {
+				notification.Read = true
+				dbs.Notifications[id] = notification
+			}
+		}
+		return nil
+	})
+}
+
+// GetUserIdsByHandles resolves handles case-insensitively, leaving out the
+// ones nobody holds
+func (db *DB) GetUserIdsByHandles(handles []string) ([]int, error) {
+	dbs, err := db.readDB()
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []int
+	seen := make(map[int]bool)
+	for _, handle := range handles {
+		if id, ok := dbs.Handles[strings.ToLower(handle)]; ok && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
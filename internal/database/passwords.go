@@ -0,0 +1,95 @@
+package database
+
+import (
+	"time"
+
+	. "github.com/mohamed2394/goserver/internal"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// CreatePasswordReset stores token as the password reset of the user with
+// email, valid until now+ttl, and returns that user. Any earlier reset of
+// the user stops working. It returns ErrNotFound if no user has the email.
+func (db *DB) CreatePasswordReset(email, token string, now time.Time, ttl time.Duration) (User, error) {
+	var user User
+	err := db.update(func(dbs *DBStructure) error {
+		found := false
+		for _, u := range dbs.Users {
+			if u.Email == email {
+				user = u
+				found = true
+				break
+			}
+		}
+		if !found {
+			return ErrNotFound
+		}
+
+		for hash, reset := range dbs.PasswordResets {
+			if reset.UserId == user.Id || !now.Before(reset.ExpiresAt) {
+				delete(dbs.PasswordResets, hash)
+			}
+		}
+		dbs.PasswordResets[hashToken(token)] = PasswordReset{
+			UserId:    user.Id,
+			CreatedAt: now.UTC(),
+			ExpiresAt: now.Add(ttl).UTC(),
+		}
+		return nil
+	})
+	return user, err
+}
+
+// ResetPassword uses the password reset token to set the password of its
+// user, and revokes all the user's sessions and pending MFA challenges. The
+// token cannot be used again.
+// It returns the id of the user, or ErrNotFound if the token is unknown,
+// used or expired.
+func (db *DB) ResetPassword(token, password string, now time.Time) (int, error) {
+	// Hash the password before taking the lock, bcrypt is slow on purpose
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return 0, err
+	}
+
+	var userId int
+	err = db.update(func(dbs *DBStructure) error {
+		hash := hashToken(token)
+		reset, ok := dbs.PasswordResets[hash]
+		if !ok {
+			return ErrNotFound
+		}
+		delete(dbs.PasswordResets, hash)
+		if !now.Before(reset.ExpiresAt) {
+			// The expired reset is still dropped, so report it after the update
+			return nil
+		}
+
+		user, ok := dbs.Users[reset.UserId]
+		if !ok {
+			return nil
+		}
+		user.Password = string(hashed)
+		dbs.Users[user.Id] = user
+		userId = user.Id
+
+		for id, session := range dbs.Sessions {
+			if session.UserId == user.Id {
+				dbs.removeSession(id)
+			}
+		}
+		for hash, challenge := range dbs.MFAChallenges {
+			if challenge.UserId == user.Id {
+				delete(dbs.MFAChallenges, hash)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if userId == 0 {
+		return 0, ErrNotFound
+	}
+	return userId, nil
+}
@@ -0,0 +1,59 @@
+package database
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	. "github.com/mohamed2394/goserver/internal"
+)
+
+var (
+	ErrNoPoll        = errors.New("chirp has no poll")
+	ErrPollClosed    = errors.New("poll is closed")
+	ErrAlreadyVoted  = errors.New("already voted in this poll")
+	ErrInvalidOption = errors.New("invalid poll option")
+)
+
+// VotePoll records userId's vote for option in the poll on chirp chirpId and
+// returns the chirp with the updated tallies. The check for an earlier vote
+// and the tally update happen in the same write, so concurrent votes can't
+// be lost or counted twice.
+func (db *DB) VotePoll(chirpId, userId, option int) (Chirp, error) {
+	var chirp Chirp
+	err := db.update(func(dbs *DBStructure) error {
+		var ok bool
+		chirp, ok = dbs.Chirps[chirpId]
+		if !ok {
+			return ErrNotFound
+		}
+		if chirp.Poll == nil {
+			return ErrNoPoll
+		}
+		if chirp.Poll.IsClosed(time.Now()) {
+			return ErrPollClosed
+		}
+		if option < 0 || option >= len(chirp.Poll.Options) {
+			return ErrInvalidOption
+		}
+
+		votes := dbs.PollVotes[chirpId]
+		if votes == nil {
+			votes = make(map[int]int)
+			dbs.PollVotes[chirpId] = votes
+		}
+		if _, voted := votes[userId]; voted {
+			return ErrAlreadyVoted
+		}
+
+		votes[userId] = option
+		chirp.Poll.Options[option].Votes++
+		dbs.Chirps[chirpId] = chirp
+		return nil
+	})
+	if err != nil {
+		return Chirp{}, err
+	}
+	log.Printf("User %d voted for option %d on chirp %d", userId, option, chirpId)
+	return chirp, nil
+}
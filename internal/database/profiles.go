@@ -0,0 +1,136 @@
+package database
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	. "github.com/mohamed2394/goserver/internal"
+)
+
+const (
+	// HandleChangeCooldown is how long a user has to wait between handle changes
+	HandleChangeCooldown = 30 * 24 * time.Hour
+	// HandleReservationPeriod is how long a given up handle stays reserved
+	// for its previous owner
+	HandleReservationPeriod = 30 * 24 * time.Hour
+)
+
+var (
+	ErrHandleTaken    = errors.New("handle is already taken")
+	ErrHandleCooldown = errors.New("handle was changed too recently")
+)
+
+// GetUserProfile returns the public profile of a user
+func (db *DB) GetUserProfile(userId int) (UserProfile, error) {
+	dbs, err := db.readDB()
+	if err != nil {
+		return UserProfile{}, err
+	}
+	user, ok := dbs.Users[userId]
+	if !ok {
+		return UserProfile{}, ErrNotFound
+	}
+	return dbs.profile(user), nil
+}
+
+// GetUserProfileByHandle returns the public profile of the user with handle,
+// matched case-insensitively
+func (db *DB) GetUserProfileByHandle(handle string) (UserProfile, error) {
+	dbs, err := db.readDB()
+	if err != nil {
+		return UserProfile{}, err
+	}
+	userId, ok := dbs.Handles[strings.ToLower(handle)]
+	if !ok {
+		return UserProfile{}, ErrNotFound
+	}
+	return dbs.profile(dbs.Users[userId]), nil
+}
+
+// UpdateProfile applies the fields present in req to userId's profile. The
+// caller validates them. Changing the handle is subject to
+// HandleChangeCooldown and reserves the old handle for HandleReservationPeriod.
+func (db *DB) UpdateProfile(userId int, req ProfileRequest) (UserProfile, error) {
+	var profile UserProfile
+	err := db.update(func(dbs *DBStructure) error {
+		user, ok := dbs.Users[userId]
+		if !ok {
+			return ErrNotFound
+		}
+
+		now := time.Now()
+		if req.Handle != nil && *req.Handle != user.Handle {
+			if err := dbs.changeHandle(&user, *req.Handle, now); err != nil {
+				return err
+			}
+		}
+		if req.DisplayName != nil {
+			user.DisplayName = *req.DisplayName
+		}
+		if req.Bio != nil {
+			user.Bio = *req.Bio
+		}
+		if req.AvatarURL != nil {
+			user.AvatarURL = *req.AvatarURL
+		}
+
+		dbs.Users[userId] = user
+		profile = dbs.profile(user)
+		return nil
+	})
+	return profile, err
+}
+
+// changeHandle moves user to handle, reserving the one they give up
+func (dbs *DBStructure) changeHandle(user *User, handle string, now time.Time) error {
+	// Changing only the case of the handle is always allowed
+	sameHandle := strings.EqualFold(handle, user.Handle)
+	if !sameHandle && !user.HandleChangedAt.IsZero() && now.Before(user.HandleChangedAt.Add(HandleChangeCooldown)) {
+		return ErrHandleCooldown
+	}
+	if !sameHandle {
+		if err := dbs.claimHandle(user.Id, handle, now); err != nil {
+			return err
+		}
+		if user.Handle != "" {
+			old := strings.ToLower(user.Handle)
+			delete(dbs.Handles, old)
+			dbs.ReservedHandles[old] = HandleReservation{
+				UserId: user.Id,
+				Until:  now.Add(HandleReservationPeriod).UTC(),
+			}
+		}
+		user.HandleChangedAt = now.UTC()
+	}
+	user.Handle = handle
+	return nil
+}
+
+// claimHandle assigns handle to userId unless another user holds or reserved it
+func (dbs *DBStructure) claimHandle(userId int, handle string, now time.Time) error {
+	key := strings.ToLower(handle)
+	if ownerId, ok := dbs.Handles[key]; ok && ownerId != userId {
+		return ErrHandleTaken
+	}
+	if reservation, ok := dbs.ReservedHandles[key]; ok {
+		if reservation.UserId != userId && now.Before(reservation.Until) {
+			return ErrHandleTaken
+		}
+		delete(dbs.ReservedHandles, key)
+	}
+	dbs.Handles[key] = userId
+	return nil
+}
+
+func (dbs *DBStructure) profile(user User) UserProfile {
+	return UserProfile{
+		Id:             user.Id,
+		Handle:         user.Handle,
+		DisplayName:    user.DisplayName,
+		Bio:            user.Bio,
+		AvatarURL:      user.AvatarURL,
+		FollowerCount:  len(dbs.Followers[user.Id]),
+		FollowingCount: len(dbs.Following[user.Id]),
+	}
+}
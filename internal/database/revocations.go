@@ -0,0 +1,70 @@
+package database
+
+import (
+	"time"
+)
+
+// RevokeAccessToken adds the access token with id jti to the denylist until
+// expiresAt, when it stops being accepted anyway. Entries that have expired
+// by now are dropped.
+func (db *DB) RevokeAccessToken(jti string, expiresAt, now time.Time) error {
+	return db.update(func(dbs *DBStructure) error {
+		for id, exp := range dbs.RevokedAccessTokens {
+			if !now.Before(exp) {
+				delete(dbs.RevokedAccessTokens, id)
+			}
+		}
+		dbs.RevokedAccessTokens[jti] = expiresAt.UTC()
+		return nil
+	})
+}
+
+// GetRevokedAccessTokens returns the denylisted access token ids that have
+// not expired by now, with their expiry
+func (db *DB) GetRevokedAccessTokens(now time.Time) (map[string]time.Time, error) {
+	dbs, err := db.readDB()
+	if err != nil {
+		return nil, err
+	}
+
+	revoked := make(map[string]time.Time)
+	for jti, exp := range dbs.RevokedAccessTokens {
+		if now.Before(exp) {
+			revoked[jti] = exp
+		}
+	}
+	return revoked, nil
+}
+
+// BumpTokenVersion increments the token version of userId and returns the
+// new version. Access tokens issued at an older version are then rejected.
+func (db *DB) BumpTokenVersion(userId int) (int, error) {
+	var version int
+	err := db.update(func(dbs *DBStructure) error {
+		user, ok := dbs.Users[userId]
+		if !ok {
+			return ErrNotFound
+		}
+		user.TokenVersion++
+		dbs.Users[userId] = user
+		version = user.TokenVersion
+		return nil
+	})
+	return version, err
+}
+
+// GetTokenVersions returns the token version of every user who has one
+func (db *DB) GetTokenVersions() (map[int]int, error) {
+	dbs, err := db.readDB()
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make(map[int]int)
+	for id, user := range dbs.Users {
+		if user.TokenVersion > 0 {
+			versions[id] = user.TokenVersion
+		}
+	}
+	return versions, nil
+}
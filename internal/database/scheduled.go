@@ -0,0 +1,123 @@
+package database
+
+import (
+	"log"
+	"sort"
+	"time"
+
+	. "github.com/mohamed2394/goserver/internal"
+)
+
+// CreateScheduledChirp stores a chirp that will be published at publishAt
+func (db *DB) CreateScheduledChirp(chirp Chirp, publishAt time.Time) (ScheduledChirp, error) {
+	log.Println("Scheduling a new chirp")
+
+	var scheduled ScheduledChirp
+	err := db.update(func(dbs *DBStructure) error {
+		if err := dbs.checkGroupPost(chirp); err != nil {
+			return err
+		}
+		// Scheduled chirps draw their ids from the chirp sequence too, so
+		// the two kinds of id are never confused
+		chirp.Id = db.ChirpIdCounter
+		chirp.CreatedAt = time.Now().UTC()
+		db.ChirpIdCounter++
+		scheduled = ScheduledChirp{
+			Chirp:     chirp,
+			PublishAt: publishAt.UTC(),
+		}
+		dbs.ScheduledChirps[scheduled.Id] = scheduled
+		return nil
+	})
+	if err != nil {
+		log.Println("Error writing database:", err)
+		return ScheduledChirp{}, err
+	}
+	return scheduled, nil
+}
+
+// GetScheduledChirps returns the pending chirps of an author, soonest first
+func (db *DB) GetScheduledChirps(authorId int) ([]ScheduledChirp, error) {
+	pending, err := db.GetPendingScheduledChirps()
+	if err != nil {
+		return nil, err
+	}
+
+	scheduled := []ScheduledChirp{}
+	for _, sc := range pending {
+		if sc.AuthorId == authorId {
+			scheduled = append(scheduled, sc)
+		}
+	}
+	return scheduled, nil
+}
+
+// GetPendingScheduledChirps returns every chirp still waiting to be published, soonest first
+func (db *DB) GetPendingScheduledChirps() ([]ScheduledChirp, error) {
+	dbs, err := db.readDB()
+	if err != nil {
+		return nil, err
+	}
+
+	pending := make([]ScheduledChirp, 0, len(dbs.ScheduledChirps))
+	for _, sc := range dbs.ScheduledChirps {
+		pending = append(pending, sc)
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		if pending[i].PublishAt.Equal(pending[j].PublishAt) {
+			return pending[i].Id < pending[j].Id
+		}
+		return pending[i].PublishAt.Before(pending[j].PublishAt)
+	})
+	return pending, nil
+}
+
+// DeleteScheduledChirp cancels a pending chirp owned by authorId
+func (db *DB) DeleteScheduledChirp(id, authorId int) error {
+	return db.update(func(dbs *DBStructure) error {
+		sc, ok := dbs.ScheduledChirps[id]
+		if !ok || sc.AuthorId != authorId {
+			return ErrNotFound
+		}
+		delete(dbs.ScheduledChirps, id)
+		return nil
+	})
+}
+
+// PublishScheduledChirp turns a pending chirp into a regular chirp in a single
+// write. The chirp gets a new id as it is published, so that feeds, which are
+// ordered and paged by id, show it as of its publication. It returns
+// ErrNotFound if the chirp was cancelled in the meantime. A group chirp whose
+// author can no longer post in the group is dropped instead of published,
+// and the error of checkGroupPost returned.
+func (db *DB) PublishScheduledChirp(id int) (Chirp, error) {
+	var chirp Chirp
+	var dropped error
+	err := db.update(func(dbs *DBStructure) error {
+		sc, ok := dbs.ScheduledChirps[id]
+		if !ok {
+			return ErrNotFound
+		}
+		if err := dbs.checkGroupPost(sc.Chirp); err != nil {
+			// The removal has to be written, so report it after the update
+			dropped = err
+			delete(dbs.ScheduledChirps, id)
+			return nil
+		}
+		chirp = sc.Chirp
+		chirp.Id = db.ChirpIdCounter
+		chirp.CreatedAt = time.Now().UTC()
+		db.ChirpIdCounter++
+		delete(dbs.ScheduledChirps, id)
+		dbs.Chirps[chirp.Id] = chirp
+		return nil
+	})
+	if err != nil {
+		return Chirp{}, err
+	}
+	if dropped != nil {
+		return Chirp{}, dropped
+	}
+	log.Printf("Published scheduled chirp %d with ID: %d", id, chirp.Id)
+	return chirp, nil
+}
@@ -0,0 +1,230 @@
+package database
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"time"
+
+	. "github.com/mohamed2394/goserver/internal"
+)
+
+var ErrRefreshTokenReused = errors.New("refresh token was already used")
+
+// CreateSession stores a new session of session.UserId, kept alive by
+// refreshToken until session.ExpiresAt. Only the hash of the token is stored.
+func (db *DB) CreateSession(session Session, refreshToken string) (Session, error) {
+	err := db.update(func(dbs *DBStructure) error {
+		if _, ok := dbs.Users[session.UserId]; !ok {
+			return ErrNotFound
+		}
+		now := time.Now().UTC()
+		dbs.pruneSessions(session.UserId, now)
+
+		session.Id = db.SessionIdCounter
+		db.SessionIdCounter++
+		dbs.NextSessionId = db.SessionIdCounter
+		session.TokenHash = hashToken(refreshToken)
+		session.CreatedAt = now
+		session.LastUsedAt = now
+		dbs.Sessions[session.Id] = session
+		dbs.SessionsByToken[session.TokenHash] = session.Id
+		return nil
+	})
+	if err != nil {
+		return Session{}, err
+	}
+	session.TokenHash = ""
+	return session, nil
+}
+
+// RotateSession exchanges refreshToken for newToken on its session and
+// records the use. It returns ErrNotFound if the token is unknown, revoked or
+// expired. If the token was already rotated, someone is replaying an old
+// token: the whole session is revoked, a security event is recorded and
+// ErrRefreshTokenReused is returned along with the revoked session's id and
+// owner.
+func (db *DB) RotateSession(refreshToken, newToken, ip, userAgent string) (Session, error) {
+	var session Session
+	reused, expired := false, false
+	err := db.update(func(dbs *DBStructure) error {
+		now := time.Now().UTC()
+		hash := hashToken(refreshToken)
+
+		if retired, ok := dbs.RetiredTokens[hash]; ok && now.Before(retired.ExpiresAt) {
+			// Changes must be written, so this is reported after the update
+			reused = true
+			session = Session{Id: retired.SessionId, UserId: retired.UserId}
+			delete(dbs.RetiredTokens, hash)
+			// Only ever revoke the family the token came from
+			if family, ok := dbs.Sessions[retired.SessionId]; ok && family.UserId == retired.UserId {
+				dbs.removeSession(retired.SessionId)
+			}
+			dbs.recordSecurityEvent(SecurityEvent{
+				UserId:    retired.UserId,
+				Type:      SecurityEventRefreshTokenReuse,
+				SessionId: retired.SessionId,
+				IP:        ip,
+				UserAgent: userAgent,
+				CreatedAt: now,
+			})
+			return nil
+		}
+
+		id, ok := dbs.SessionsByToken[hash]
+		if !ok {
+			return ErrNotFound
+		}
+		session = dbs.Sessions[id]
+		if !now.Before(session.ExpiresAt) {
+			// The removal must be written, so this is reported after the update
+			expired = true
+			dbs.removeSession(id)
+			return nil
+		}
+
+		delete(dbs.SessionsByToken, hash)
+		dbs.RetiredTokens[hash] = RetiredToken{
+			SessionId: id,
+			UserId:    session.UserId,
+			ExpiresAt: session.ExpiresAt,
+		}
+		session.TokenHash = hashToken(newToken)
+		dbs.SessionsByToken[session.TokenHash] = id
+		session.LastUsedAt = now
+		session.IP = ip
+		session.UserAgent = userAgent
+		dbs.Sessions[id] = session
+		return nil
+	})
+	if err != nil {
+		return Session{}, err
+	}
+	if reused {
+		return session, ErrRefreshTokenReused
+	}
+	if expired {
+		return Session{}, ErrNotFound
+	}
+	session.TokenHash = ""
+	return session, nil
+}
+
+// GetSessions returns the live sessions of userId, most recently used first
+func (db *DB) GetSessions(userId int) ([]Session, error) {
+	dbs, err := db.readDB()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	sessions := []Session{}
+	for _, session := range dbs.Sessions {
+		if session.UserId == userId && now.Before(session.ExpiresAt) {
+			session.TokenHash = ""
+			sessions = append(sessions, session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		if sessions[i].LastUsedAt.Equal(sessions[j].LastUsedAt) {
+			return sessions[i].Id > sessions[j].Id
+		}
+		return sessions[i].LastUsedAt.After(sessions[j].LastUsedAt)
+	})
+	return sessions, nil
+}
+
+// DeleteSession revokes a session of userId
+func (db *DB) DeleteSession(id, userId int) error {
+	return db.update(func(dbs *DBStructure) error {
+		session, ok := dbs.Sessions[id]
+		if !ok || session.UserId != userId {
+			return ErrNotFound
+		}
+		dbs.removeSession(id)
+		return nil
+	})
+}
+
+// DeleteSessionByToken revokes the session of refreshToken
+func (db *DB) DeleteSessionByToken(refreshToken string) error {
+	return db.update(func(dbs *DBStructure) error {
+		id, ok := dbs.SessionsByToken[hashToken(refreshToken)]
+		if !ok {
+			return ErrNotFound
+		}
+		dbs.removeSession(id)
+		return nil
+	})
+}
+
+// DeleteUserSessions revokes every session of userId and returns how many there were
+func (db *DB) DeleteUserSessions(userId int) (int, error) {
+	var count int
+	err := db.update(func(dbs *DBStructure) error {
+		for id, session := range dbs.Sessions {
+			if session.UserId == userId {
+				dbs.removeSession(id)
+				count++
+			}
+		}
+		return nil
+	})
+	return count, err
+}
+
+// removeSession deletes a session along with the refresh tokens it retired
+func (dbs *DBStructure) removeSession(id int) {
+	delete(dbs.SessionsByToken, dbs.Sessions[id].TokenHash)
+	delete(dbs.Sessions, id)
+	for hash, retired := range dbs.RetiredTokens {
+		if retired.SessionId == id {
+			delete(dbs.RetiredTokens, hash)
+		}
+	}
+}
+
+// pruneSessions drops the expired sessions and retired tokens of userId
+func (dbs *DBStructure) pruneSessions(userId int, now time.Time) {
+	for id, session := range dbs.Sessions {
+		if session.UserId == userId && !now.Before(session.ExpiresAt) {
+			dbs.removeSession(id)
+		}
+	}
+	for hash, retired := range dbs.RetiredTokens {
+		if retired.UserId == userId && !now.Before(retired.ExpiresAt) {
+			delete(dbs.RetiredTokens, hash)
+		}
+	}
+}
+
+// GetSecurityEvents returns the security events of userId, newest first
+func (db *DB) GetSecurityEvents(userId int) ([]SecurityEvent, error) {
+	dbs, err := db.readDB()
+	if err != nil {
+		return nil, err
+	}
+
+	events := []SecurityEvent{}
+	for _, event := range dbs.SecurityEvents {
+		if event.UserId == userId {
+			events = append(events, event)
+		}
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].Id > events[j].Id })
+	return events, nil
+}
+
+func (dbs *DBStructure) recordSecurityEvent(event SecurityEvent) {
+	event.Id = nextId(dbs.SecurityEvents)
+	dbs.SecurityEvents[event.Id] = event
+}
+
+// hashToken returns the hex SHA-256 of a refresh token. Refresh tokens are
+// long random strings, so a fast unsalted hash is enough to make a leaked
+// database useless for logging in.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
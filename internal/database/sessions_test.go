@@ -0,0 +1,144 @@
+package database
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/mohamed2394/goserver/internal"
+)
+
+// newTestDB returns a database in a temporary directory with one user
+func newTestDB(t *testing.T) (*DB, User) {
+	t.Helper()
+	db, err := NewDB(filepath.Join(t.TempDir(), "database.json"))
+	if err != nil {
+		t.Fatalf("NewDB: %v", err)
+	}
+	user, err := db.CreateUser("walt@example.com", "password", "")
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	return db, user
+}
+
+func createTestSession(t *testing.T, db *DB, userId int, token string, expiresAt time.Time) Session {
+	t.Helper()
+	session, err := db.CreateSession(Session{UserId: userId, ExpiresAt: expiresAt}, token)
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	return session
+}
+
+func TestRotateSession(t *testing.T) {
+	db, user := newTestDB(t)
+	session := createTestSession(t, db, user.Id, "first", time.Now().Add(time.Hour))
+
+	rotated, err := db.RotateSession("first", "second", "127.0.0.1", "test")
+	if err != nil {
+		t.Fatalf("RotateSession: %v", err)
+	}
+	if rotated.Id != session.Id {
+		t.Errorf("rotated session id = %d, want %d", rotated.Id, session.Id)
+	}
+
+	dbs, err := db.readDB()
+	if err != nil {
+		t.Fatalf("readDB: %v", err)
+	}
+	retired, ok := dbs.RetiredTokens[hashToken("first")]
+	if !ok || retired.SessionId != session.Id {
+		t.Errorf("old token not retired: %+v", dbs.RetiredTokens)
+	}
+	if _, ok := dbs.SessionsByToken[hashToken("first")]; ok {
+		t.Error("old token still opens the session")
+	}
+	if id := dbs.SessionsByToken[hashToken("second")]; id != session.Id {
+		t.Errorf("new token opens session %d, want %d", id, session.Id)
+	}
+}
+
+func TestRotateSessionReuse(t *testing.T) {
+	db, user := newTestDB(t)
+	stolen := createTestSession(t, db, user.Id, "first", time.Now().Add(time.Hour))
+	other := createTestSession(t, db, user.Id, "other", time.Now().Add(time.Hour))
+
+	if _, err := db.RotateSession("first", "second", "127.0.0.1", "test"); err != nil {
+		t.Fatalf("RotateSession: %v", err)
+	}
+	revoked, err := db.RotateSession("first", "third", "10.0.0.1", "attacker")
+	if !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("replaying a retired token: err = %v, want ErrRefreshTokenReused", err)
+	}
+	if revoked.Id != stolen.Id || revoked.UserId != user.Id {
+		t.Errorf("revoked session = %d of user %d, want %d of user %d", revoked.Id, revoked.UserId, stolen.Id, user.Id)
+	}
+
+	// Only the session the token came from is revoked
+	if _, err := db.RotateSession("second", "fourth", "127.0.0.1", "test"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("current token of the revoked session: err = %v, want ErrNotFound", err)
+	}
+	sessions, err := db.GetSessions(user.Id)
+	if err != nil {
+		t.Fatalf("GetSessions: %v", err)
+	}
+	if len(sessions) != 1 || sessions[0].Id != other.Id {
+		t.Errorf("sessions left = %+v, want only %d", sessions, other.Id)
+	}
+
+	events, err := db.GetSecurityEvents(user.Id)
+	if err != nil {
+		t.Fatalf("GetSecurityEvents: %v", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("%d security events, want 1", len(events))
+	}
+	event := events[0]
+	if event.Type != SecurityEventRefreshTokenReuse || event.SessionId != stolen.Id || event.IP != "10.0.0.1" {
+		t.Errorf("security event = %+v", event)
+	}
+}
+
+func TestRotateSessionExpired(t *testing.T) {
+	db, user := newTestDB(t)
+	session := createTestSession(t, db, user.Id, "first", time.Now().Add(-time.Minute))
+
+	if _, err := db.RotateSession("first", "second", "127.0.0.1", "test"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("RotateSession on an expired session: err = %v, want ErrNotFound", err)
+	}
+
+	dbs, err := db.readDB()
+	if err != nil {
+		t.Fatalf("readDB: %v", err)
+	}
+	if _, ok := dbs.Sessions[session.Id]; ok {
+		t.Error("expired session was not removed")
+	}
+	if _, ok := dbs.SessionsByToken[hashToken("first")]; ok {
+		t.Error("token of the expired session was not removed")
+	}
+}
+
+func TestSessionIdsSurviveRestart(t *testing.T) {
+	db, user := newTestDB(t)
+	first := createTestSession(t, db, user.Id, "first", time.Now().Add(time.Hour))
+	second := createTestSession(t, db, user.Id, "second", time.Now().Add(time.Hour))
+	if second.Id <= first.Id {
+		t.Fatalf("second session id %d, want more than %d", second.Id, first.Id)
+	}
+	// Nothing refers to the newest id once its session is gone
+	if err := db.DeleteSession(second.Id, user.Id); err != nil {
+		t.Fatalf("DeleteSession: %v", err)
+	}
+
+	reloaded, err := NewDB(db.Path)
+	if err != nil {
+		t.Fatalf("NewDB: %v", err)
+	}
+	third := createTestSession(t, reloaded, user.Id, "third", time.Now().Add(time.Hour))
+	if third.Id <= second.Id {
+		t.Errorf("session id after restart = %d, want more than %d", third.Id, second.Id)
+	}
+}
@@ -0,0 +1,121 @@
+package database
+
+import (
+	"sort"
+	"time"
+
+	. "github.com/mohamed2394/goserver/internal"
+)
+
+const (
+	// suggestionActivityWindow is how far back a candidate's chirps count as recent activity
+	suggestionActivityWindow = 7 * 24 * time.Hour
+	// Caps keep a single prolific poster or chatty pair from drowning out
+	// the social graph in the ranking
+	maxActivitySignal    = 10
+	maxInteractionSignal = 5
+
+	mutualFollowWeight = 3.0
+	interactionWeight  = 2.0
+	activityWeight     = 0.5
+)
+
+// SuggestUsers ranks accounts for userId to follow and returns at most limit
+// of them, best first. Candidates are followed by accounts userId follows,
+// follow userId, or have talked to or mentioned userId. They are scored by
+// that friends-of-friends overlap, their interactions with userId and how
+// much they posted recently. Accounts userId already follows, has muted, or
+// is on either side of a block with are left out.
+func (db *DB) SuggestUsers(userId int, now time.Time, limit int) ([]UserSuggestion, error) {
+	dbs, err := db.readDB()
+	if err != nil {
+		return nil, err
+	}
+
+	mutuals := make(map[int]int)
+	for followeeId := range dbs.Following[userId] {
+		for candidateId := range dbs.Following[followeeId] {
+			mutuals[candidateId]++
+		}
+	}
+
+	interactions := make(map[int]int)
+	for followerId := range dbs.Followers[userId] {
+		interactions[followerId]++
+	}
+	for _, conversation := range dbs.Conversations {
+		if !conversation.HasParticipant(userId) || len(dbs.Messages[conversation.Id]) == 0 {
+			continue
+		}
+		for _, participantId := range conversation.ParticipantIds {
+			if participantId != userId {
+				interactions[participantId]++
+			}
+		}
+	}
+	for _, notification := range dbs.Notifications {
+		if notification.Type != NotificationMention {
+			continue
+		}
+		switch userId {
+		case notification.UserId:
+			interactions[notification.ActorId]++
+		case notification.ActorId:
+			interactions[notification.UserId]++
+		}
+	}
+
+	activity := make(map[int]int)
+	since := now.Add(-suggestionActivityWindow)
+	for _, chirp := range dbs.Chirps {
+		if chirp.CreatedAt.After(since) {
+			activity[chirp.AuthorId]++
+		}
+	}
+
+	candidates := make(map[int]bool)
+	for candidateId := range mutuals {
+		candidates[candidateId] = true
+	}
+	for candidateId := range interactions {
+		candidates[candidateId] = true
+	}
+
+	suggestions := []UserSuggestion{}
+	for candidateId := range candidates {
+		user, ok := dbs.Users[candidateId]
+		if !ok || candidateId == userId || !dbs.suggestible(userId, candidateId) {
+			continue
+		}
+		score := mutualFollowWeight*float64(mutuals[candidateId]) +
+			interactionWeight*float64(min(interactions[candidateId], maxInteractionSignal)) +
+			activityWeight*float64(min(activity[candidateId], maxActivitySignal))
+		suggestions = append(suggestions, UserSuggestion{
+			UserProfile:   dbs.profile(user),
+			MutualFollows: mutuals[candidateId],
+			Score:         score,
+		})
+	}
+
+	sort.Slice(suggestions, func(i, j int) bool {
+		if suggestions[i].Score == suggestions[j].Score {
+			return suggestions[i].Id < suggestions[j].Id
+		}
+		return suggestions[i].Score > suggestions[j].Score
+	})
+	if len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+	return suggestions, nil
+}
+
+// suggestible reports whether candidateId may be suggested to userId
+func (dbs *DBStructure) suggestible(userId, candidateId int) bool {
+	if _, ok := dbs.Following[userId][candidateId]; ok {
+		return false
+	}
+	if _, ok := dbs.Mutes[userId][candidateId]; ok {
+		return false
+	}
+	return !dbs.isBlocked(userId, candidateId)
+}
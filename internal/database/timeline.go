@@ -0,0 +1,88 @@
+package database
+
+import (
+	"sort"
+
+	. "github.com/mohamed2394/goserver/internal"
+)
+
+// maxInboxSize is how many chirp ids an inbox keeps before dropping the oldest
+const maxInboxSize = 1000
+
+// GetFollowerIds returns the ids of the users following userId
+func (db *DB) GetFollowerIds(userId int) ([]int, error) {
+	dbs, err := db.readDB()
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int, 0, len(dbs.Followers[userId]))
+	for id := range dbs.Followers[userId] {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
+
+// DeliverToInboxes appends chirpId to the inbox of every user in userIds in a single write
+func (db *DB) DeliverToInboxes(chirpId int, userIds []int) error {
+	return db.update(func(dbs *DBStructure) error {
+		for _, userId := range userIds {
+			inbox := append(dbs.Inboxes[userId], chirpId)
+			if len(inbox) > maxInboxSize {
+				inbox = inbox[len(inbox)-maxInboxSize:]
+			}
+			dbs.Inboxes[userId] = inbox
+		}
+		return nil
+	})
+}
+
+// GetTimelineChirps returns the candidate chirps for userId's home timeline,
+// newest first. Chirps from followed accounts with at most fanOutThreshold
+// followers come from the user's inbox; chirps from larger accounts are not
+// fanned out and are read from their authors here instead. Chirps from
+// accounts the user no longer follows are left out.
+func (db *DB) GetTimelineChirps(userId, fanOutThreshold int) ([]Chirp, error) {
+	dbs, err := db.readDB()
+	if err != nil {
+		return nil, err
+	}
+
+	following := dbs.Following[userId]
+	include := func(chirp Chirp) bool {
+		if chirp.AuthorId == userId {
+			return true
+		}
+		_, ok := following[chirp.AuthorId]
+		return ok
+	}
+
+	seen := make(map[int]bool)
+	var chirps []Chirp
+	for _, id := range dbs.Inboxes[userId] {
+		chirp, ok := dbs.Chirps[id]
+		if !ok || seen[id] || !include(chirp) {
+			continue
+		}
+		seen[id] = true
+		chirps = append(chirps, chirp)
+	}
+
+	heavy := make(map[int]bool)
+	for followeeId := range following {
+		if len(dbs.Followers[followeeId]) > fanOutThreshold {
+			heavy[followeeId] = true
+		}
+	}
+	if len(heavy) > 0 {
+		for id, chirp := range dbs.Chirps {
+			if heavy[chirp.AuthorId] && !seen[id] {
+				seen[id] = true
+				chirps = append(chirps, chirp)
+			}
+		}
+	}
+
+	sort.Slice(chirps, func(i, j int) bool { return chirps[i].Id > chirps[j].Id })
+	return chirps, nil
+}
@@ -0,0 +1,194 @@
+package database
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	. "github.com/mohamed2394/goserver/internal"
+)
+
+// maxMFAAttempts is how many wrong codes end an MFA challenge
+const maxMFAAttempts = 5
+
+var (
+	ErrTwoFactorEnabled    = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotEnabled = errors.New("two-factor authentication is not enabled")
+	ErrInvalidCode         = errors.New("invalid code")
+)
+
+// CodeCheck validates an authenticator code against secret, skipping time
+// steps up to and including after, and returns the time step it matched
+type CodeCheck func(secret, code string, after int64) (int64, bool)
+
+// GetTwoFactor returns the two-factor enrolment of userId, which is empty if
+// the user never enrolled
+func (db *DB) GetTwoFactor(userId int) (TwoFactor, error) {
+	dbs, err := db.readDB()
+	if err != nil {
+		return TwoFactor{}, err
+	}
+	tf, ok := dbs.TwoFactor[userId]
+	if !ok {
+		return TwoFactor{UserId: userId}, nil
+	}
+	return tf, nil
+}
+
+// StartTwoFactorSetup gives userId secret to enrol in an authenticator,
+// replacing any setup not confirmed yet
+func (db *DB) StartTwoFactorSetup(userId int, secret string) error {
+	return db.update(func(dbs *DBStructure) error {
+		if _, ok := dbs.Users[userId]; !ok {
+			return ErrNotFound
+		}
+		tf := dbs.TwoFactor[userId]
+		if tf.Enabled() {
+			return ErrTwoFactorEnabled
+		}
+		tf.UserId = userId
+		tf.PendingSecret = secret
+		dbs.TwoFactor[userId] = tf
+		return nil
+	})
+}
+
+// ConfirmTwoFactorSetup enables two-factor authentication for userId if code
+// is valid for the pending secret. recoveryCodes become the user's recovery
+// codes; only their hashes are stored.
+func (db *DB) ConfirmTwoFactorSetup(userId int, code string, check CodeCheck, recoveryCodes []string) error {
+	return db.update(func(dbs *DBStructure) error {
+		tf, ok := dbs.TwoFactor[userId]
+		if tf.Enabled() {
+			return ErrTwoFactorEnabled
+		}
+		if !ok || tf.PendingSecret == "" {
+			return ErrNotFound
+		}
+		counter, ok := check(tf.PendingSecret, code, 0)
+		if !ok {
+			return ErrInvalidCode
+		}
+
+		now := time.Now().UTC()
+		tf.Secret = tf.PendingSecret
+		tf.PendingSecret = ""
+		tf.LastCounter = counter
+		tf.RecoveryCodes = make([]string, len(recoveryCodes))
+		for i, rc := range recoveryCodes {
+			tf.RecoveryCodes[i] = hashToken(normalizeRecoveryCode(rc))
+		}
+		tf.EnabledAt = &now
+		dbs.TwoFactor[userId] = tf
+		return nil
+	})
+}
+
+// DisableTwoFactor turns two-factor authentication off for userId if req
+// holds a valid authenticator code or recovery code
+func (db *DB) DisableTwoFactor(userId int, req TwoFactorRequest, check CodeCheck) error {
+	return db.update(func(dbs *DBStructure) error {
+		if err := dbs.verifyTwoFactor(userId, req, check); err != nil {
+			return err
+		}
+		delete(dbs.TwoFactor, userId)
+		return nil
+	})
+}
+
+// CreateMFAChallenge stores challenge under token and drops the expired
+// challenges
+func (db *DB) CreateMFAChallenge(challenge MFAChallenge, token string) error {
+	return db.update(func(dbs *DBStructure) error {
+		for hash, c := range dbs.MFAChallenges {
+			if !challenge.CreatedAt.Before(c.ExpiresAt) {
+				delete(dbs.MFAChallenges, hash)
+			}
+		}
+		dbs.MFAChallenges[hashToken(token)] = challenge
+		return nil
+	})
+}
+
+// CompleteMFAChallenge checks the second factor in req for the challenge with
+// token and returns the challenge, which cannot be used again. A wrong code
+// returns ErrInvalidCode and counts as an attempt; after maxMFAAttempts the
+// challenge is dropped. An unknown or expired challenge returns ErrNotFound.
+func (db *DB) CompleteMFAChallenge(token string, req TwoFactorRequest, check CodeCheck, now time.Time) (MFAChallenge, error) {
+	var challenge MFAChallenge
+	failed := false
+	err := db.update(func(dbs *DBStructure) error {
+		hash := hashToken(token)
+		var ok bool
+		challenge, ok = dbs.MFAChallenges[hash]
+		if !ok {
+			return ErrNotFound
+		}
+		if !now.Before(challenge.ExpiresAt) {
+			delete(dbs.MFAChallenges, hash)
+			return ErrNotFound
+		}
+
+		err := dbs.verifyTwoFactor(challenge.UserId, req, check)
+		if errors.Is(err, ErrInvalidCode) {
+			// The attempt has to be written, so the failure is reported after the update
+			failed = true
+			challenge.Attempts++
+			if challenge.Attempts >= maxMFAAttempts {
+				delete(dbs.MFAChallenges, hash)
+			} else {
+				dbs.MFAChallenges[hash] = challenge
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		delete(dbs.MFAChallenges, hash)
+		return nil
+	})
+	if err != nil {
+		return MFAChallenge{}, err
+	}
+	if failed {
+		return MFAChallenge{}, ErrInvalidCode
+	}
+	return challenge, nil
+}
+
+// verifyTwoFactor checks the authenticator code or, if given, the recovery
+// code in req for userId. A used recovery code is removed and an accepted
+// authenticator code's time step is remembered, so neither works twice.
+func (dbs *DBStructure) verifyTwoFactor(userId int, req TwoFactorRequest, check CodeCheck) error {
+	tf, ok := dbs.TwoFactor[userId]
+	if !ok || !tf.Enabled() {
+		return ErrTwoFactorNotEnabled
+	}
+
+	if req.RecoveryCode != "" {
+		hash := hashToken(normalizeRecoveryCode(req.RecoveryCode))
+		for i, rc := range tf.RecoveryCodes {
+			if rc == hash {
+				tf.RecoveryCodes = append(tf.RecoveryCodes[:i:i], tf.RecoveryCodes[i+1:]...)
+				dbs.TwoFactor[userId] = tf
+				return nil
+			}
+		}
+		return ErrInvalidCode
+	}
+
+	counter, ok := check(tf.Secret, req.Code, tf.LastCounter)
+	if !ok {
+		return ErrInvalidCode
+	}
+	tf.LastCounter = counter
+	dbs.TwoFactor[userId] = tf
+	return nil
+}
+
+// normalizeRecoveryCode lets recovery codes be typed in any case, with or
+// without the dash
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
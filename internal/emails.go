@@ -0,0 +1,35 @@
+package internal
+
+import (
+	"errors"
+	"net/mail"
+	"strings"
+)
+
+// maxEmailLength is the longest address that can be delivered to, in bytes
+const maxEmailLength = 254
+
+var ErrInvalidEmail = errors.New("Invalid email address")
+
+// NormalizeEmail checks that email is a bare address such as
+// "someone@example.com" and returns it trimmed, with the domain lowercased.
+// The local part is kept as is, since mail servers may treat it as case
+// sensitive.
+func NormalizeEmail(email string) (string, error) {
+	email = strings.TrimSpace(email)
+	if len(email) > maxEmailLength {
+		return "", ErrInvalidEmail
+	}
+	// Display names and comments are accepted by the parser but not here
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return "", ErrInvalidEmail
+	}
+
+	at := strings.LastIndex(email, "@")
+	local, domain := email[:at], strings.ToLower(email[at+1:])
+	if !strings.Contains(domain, ".") || strings.HasPrefix(domain, ".") || strings.HasSuffix(domain, ".") {
+		return "", ErrInvalidEmail
+	}
+	return local + "@" + domain, nil
+}
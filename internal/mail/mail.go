@@ -0,0 +1,102 @@
+// Package mail sends the emails Chirpy needs, such as password resets
+package mail
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	netmail "net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers messages
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// SMTPMailer delivers messages through an SMTP server. From is the From:
+// header, which may include a display name, and Sender the bare address the
+// server is given as the envelope sender. Auth may be nil for servers that
+// accept unauthenticated mail.
+type SMTPMailer struct {
+	Addr   string
+	From   string
+	Sender string
+	Auth   smtp.Auth
+}
+
+// NewSMTPMailer returns a mailer sending from from, an address such as
+// "Chirpy <no-reply@example.com>", through the server at addr (host:port),
+// logging in with username and password if username is set
+func NewSMTPMailer(addr, from, username, password string) (*SMTPMailer, error) {
+	sender, err := netmail.ParseAddress(from)
+	if err != nil {
+		return nil, fmt.Errorf("invalid from address %q: %w", from, err)
+	}
+	m := &SMTPMailer{Addr: addr, From: from, Sender: sender.Address}
+	if username != "" {
+		host, _, _ := strings.Cut(addr, ":")
+		m.Auth = smtp.PlainAuth("", username, password, host)
+	}
+	return m, nil
+}
+
+func (m *SMTPMailer) Send(msg Message) error {
+	return smtp.SendMail(m.Addr, m.Auth, m.Sender, []string{msg.To}, format(m.From, msg, time.Now()))
+}
+
+// OutboxMailer writes each message to a file in Dir instead of delivering
+// it, for local development and tests
+type OutboxMailer struct {
+	Dir  string
+	From string
+}
+
+// NewOutboxMailer returns a mailer writing to dir, creating it if needed
+func NewOutboxMailer(dir, from string) (*OutboxMailer, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &OutboxMailer{Dir: dir, From: from}, nil
+}
+
+// Send writes msg to a new .eml file, named so the files sort by time
+func (m *OutboxMailer) Send(msg Message) error {
+	now := time.Now()
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", now.UTC().Format("20060102T150405.000000000"), hex.EncodeToString(suffix))
+	return os.WriteFile(filepath.Join(m.Dir, name), format(m.From, msg, now), 0o600)
+}
+
+// format renders msg as an RFC 5322 message
+func format(from string, msg Message, now time.Time) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", headerValue(from))
+	fmt.Fprintf(&b, "To: %s\r\n", headerValue(msg.To))
+	fmt.Fprintf(&b, "Subject: %s\r\n", headerValue(msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+// headerValue strips line breaks so a value cannot inject extra headers
+func headerValue(v string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(v)
+}
@@ -0,0 +1,51 @@
+package totp
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 seed of the RFC 6238 Appendix B test vectors
+var rfcSecret = base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestCode(t *testing.T) {
+	// RFC 6238 Appendix B lists 8 digit codes; these are their last 6 digits
+	tests := []struct {
+		counter int64
+		want    string
+	}{
+		{1, "287082"},
+		{37037036, "081804"},
+		{41152263, "005924"},
+	}
+	for _, tt := range tests {
+		got, err := Code(rfcSecret, tt.counter)
+		if err != nil {
+			t.Fatalf("Code(%d): %v", tt.counter, err)
+		}
+		if got != tt.want {
+			t.Errorf("Code(%d) = %q, want %q", tt.counter, got, tt.want)
+		}
+	}
+}
+
+func TestValidateReplay(t *testing.T) {
+	// 1111111109 is the RFC 6238 test time for step 37037036
+	now := time.Unix(1111111109, 0)
+	current := Counter(now)
+
+	counter, ok := Validate(rfcSecret, "081804", now, 0)
+	if !ok || counter != current {
+		t.Fatalf("Validate = %d, %v; want %d, true", counter, ok, current)
+	}
+	if _, ok := Validate(rfcSecret, "081804", now, counter-1); !ok {
+		t.Errorf("code rejected with after before its step")
+	}
+	if _, ok := Validate(rfcSecret, "081804", now, counter); ok {
+		t.Errorf("code accepted again with after at its step")
+	}
+	if _, ok := Validate(rfcSecret, "081804", now, counter+1); ok {
+		t.Errorf("code accepted with after past its step")
+	}
+}
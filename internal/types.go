@@ -2,28 +2,418 @@ package internal
 
 import "time"
 
+// Chirp visibility levels. Chirps stored before visibility existed have an
+// empty value and are treated as public.
+const (
+	VisibilityPublic    = "public"
+	VisibilityFollowers = "followers"
+	VisibilityPrivate   = "private"
+)
+
 type Chirp struct {
-	Id       int    `json:"id"`
-	Body     string `json:"body"`
-	AuthorId int    `json:"author_id"`
+	Id         int        `json:"id"`
+	Body       string     `json:"body"`
+	AuthorId   int        `json:"author_id"`
+	Visibility string     `json:"visibility"`
+	Poll       *Poll      `json:"poll,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	// GroupId is the group the chirp was posted into, or 0
+	GroupId int `json:"group_id,omitempty"`
+}
+
+// IsExpired reports whether an ephemeral chirp has expired by now
+func (c Chirp) IsExpired(now time.Time) bool {
+	return c.ExpiresAt != nil && !now.Before(*c.ExpiresAt)
 }
 
 type ChirpRequest struct {
-	Body string `json:"body"`
+	Body       string       `json:"body"`
+	Visibility string       `json:"visibility,omitempty"`
+	PublishAt  *time.Time   `json:"publish_at,omitempty"`
+	Poll       *PollRequest `json:"poll,omitempty"`
+	// ExpiresIn makes the chirp disappear this many seconds after it is published
+	ExpiresIn int `json:"expires_in,omitempty"`
+	GroupId   int `json:"group_id,omitempty"`
+}
+
+// Poll is attached to a chirp. Votes are tallied on the options as they are
+// cast and no more are accepted once ClosesAt has passed.
+type Poll struct {
+	Options  []PollOption `json:"options"`
+	ClosesAt time.Time    `json:"closes_at"`
+	Closed   bool         `json:"closed"`
+}
+
+type PollOption struct {
+	Text  string `json:"text"`
+	Votes int    `json:"votes"`
+}
+
+// IsClosed reports whether the poll stopped accepting votes by now
+func (p *Poll) IsClosed(now time.Time) bool {
+	return !now.Before(p.ClosesAt)
+}
+
+type PollRequest struct {
+	Options  []string  `json:"options"`
+	ClosesAt time.Time `json:"closes_at"`
+}
+
+// Bookmark is a chirp a user saved privately
+type Bookmark struct {
+	Chirp     Chirp     `json:"chirp"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type VoteRequest struct {
+	Option int `json:"option"`
+}
+
+// ScheduledChirp is a chirp waiting to be published at PublishAt. Its id
+// identifies the schedule; the chirp gets a new id when it is published.
+type ScheduledChirp struct {
+	Chirp
+	PublishAt time.Time `json:"publish_at"`
+}
+
+// Draft is an unfinished chirp that only its author can see
+type Draft struct {
+	Id         int       `json:"id"`
+	Body       string    `json:"body"`
+	AuthorId   int       `json:"author_id"`
+	Visibility string    `json:"visibility"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+type DraftRequest struct {
+	Body       string `json:"body"`
+	Visibility string `json:"visibility,omitempty"`
 }
 
 type User struct {
-	Id                    int       `json:"id"`
-	Password              string    `json:"password"`
-	Email                 string    `json:"email"`
-	RefreshToken          string    `json:"refresh_token"`
-	RefreshExpirationDate time.Time `json:"refresh_expiration_date"`
+	Id              int       `json:"id"`
+	Password        string    `json:"password"`
+	Email           string    `json:"email"`
+	Handle          string    `json:"handle"`
+	HandleChangedAt time.Time `json:"handle_changed_at"`
+	DisplayName     string    `json:"display_name"`
+	Bio             string    `json:"bio"`
+	AvatarURL       string    `json:"avatar_url"`
+	// TokenVersion is bumped to invalidate every access token issued so far
+	TokenVersion int `json:"token_version"`
+	// Verified is set once the user proved they receive mail at Email
+	Verified bool `json:"verified"`
+	// PredatesVerification marks accounts created before emails were
+	// verified, which the verified email policy does not apply to
+	PredatesVerification bool `json:"predates_verification,omitempty"`
+}
+
+// Session is a login on one device, kept alive by its refresh token. Each
+// refresh replaces the token, so a session is one family of refresh tokens.
+// Only a hash of the current token is stored, and it is left out of API
+// responses.
+type Session struct {
+	Id          int       `json:"id"`
+	UserId      int       `json:"user_id"`
+	TokenHash   string    `json:"token_hash,omitempty"`
+	DeviceLabel string    `json:"device_label"`
+	IP          string    `json:"ip"`
+	UserAgent   string    `json:"user_agent"`
+	CreatedAt   time.Time `json:"created_at"`
+	LastUsedAt  time.Time `json:"last_used_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	// ExpiresInSeconds is the access token lifetime asked for at login,
+	// which refreshes keep issuing; zero means the default
+	ExpiresInSeconds int `json:"expires_in_seconds,omitempty"`
+}
+
+// PasswordReset lets the holder of its token set a new password for UserId
+// once, until ExpiresAt. Only a hash of the token is stored.
+type PasswordReset struct {
+	UserId    int       `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// PasswordResetRequest asks for a password reset link to be emailed
+type PasswordResetRequest struct {
+	Email string `json:"email"`
+}
+
+// PasswordResetConfirmRequest sets a new password with a reset token
+type PasswordResetConfirmRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// EmailVerification lets the holder of its token confirm that UserId
+// receives mail at Email, until ExpiresAt. Only a hash of the token is stored.
+type EmailVerification struct {
+	UserId    int       `json:"user_id"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// VerifyEmailRequest confirms an email address with a verification token
+type VerifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+// TwoFactor is a user's enrolment in TOTP two-factor authentication
+type TwoFactor struct {
+	UserId int `json:"user_id"`
+	// Secret is the TOTP secret, set once enrolment has been confirmed
+	Secret string `json:"secret,omitempty"`
+	// PendingSecret waits for a code from the authenticator it was given to
+	PendingSecret string `json:"pending_secret,omitempty"`
+	// LastCounter is the time step of the last code accepted, so no code
+	// is accepted twice
+	LastCounter int64 `json:"last_counter"`
+	// RecoveryCodes holds the hashes of the unused recovery codes
+	RecoveryCodes []string   `json:"recovery_codes"`
+	EnabledAt     *time.Time `json:"enabled_at,omitempty"`
+}
+
+// Enabled reports whether logging in requires a second factor
+func (tf TwoFactor) Enabled() bool {
+	return tf.Secret != ""
+}
+
+// MFAChallenge is a login that passed the password check and waits for the
+// second factor. Only a hash of its token is stored.
+type MFAChallenge struct {
+	UserId           int       `json:"user_id"`
+	DeviceLabel      string    `json:"device_label"`
+	ExpiresInSeconds int       `json:"expires_in_seconds"`
+	Attempts         int       `json:"attempts"`
+	CreatedAt        time.Time `json:"created_at"`
+	ExpiresAt        time.Time `json:"expires_at"`
+}
+
+// TwoFactorRequest proves the second factor with either an authenticator
+// code or a recovery code
+type TwoFactorRequest struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// MFALoginRequest finishes a login that returned an MFA challenge
+type MFALoginRequest struct {
+	MFAToken string `json:"mfa_token"`
+	TwoFactorRequest
+}
+
+// RetiredToken is a refresh token that was replaced by rotation. Presenting
+// it again means it was stolen from one of the parties that held it.
+type RetiredToken struct {
+	SessionId int       `json:"session_id"`
+	UserId    int       `json:"user_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Security event types
+const (
+	SecurityEventRefreshTokenReuse = "refresh_token_reuse"
+)
+
+// SecurityEvent records something suspicious that happened to an account
+type SecurityEvent struct {
+	Id        int       `json:"id"`
+	UserId    int       `json:"user_id"`
+	Type      string    `json:"type"`
+	SessionId int       `json:"session_id,omitempty"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// HandleReservation keeps a handle its previous owner gave up from being
+// claimed by anyone else until Until
+type HandleReservation struct {
+	UserId int       `json:"user_id"`
+	Until  time.Time `json:"until"`
+}
+
+// Follow is one end of a follow edge in a followers or following listing
+type Follow struct {
+	UserId    int       `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Conversation is a private 1:1 conversation. LastRead maps each participant
+// to the id of the last message they have read and doubles as read receipts.
+type Conversation struct {
+	Id             int         `json:"id"`
+	ParticipantIds []int       `json:"participant_ids"`
+	LastRead       map[int]int `json:"last_read"`
+	CreatedAt      time.Time   `json:"created_at"`
+	LastMessageAt  time.Time   `json:"last_message_at"`
+}
+
+// HasParticipant reports whether userId takes part in the conversation
+func (c Conversation) HasParticipant(userId int) bool {
+	for _, id := range c.ParticipantIds {
+		if id == userId {
+			return true
+		}
+	}
+	return false
+}
+
+// ConversationSummary is a conversation as seen by one of its participants
+type ConversationSummary struct {
+	Conversation
+	UnreadCount int `json:"unread_count"`
+}
+
+// Message ids are sequential within their conversation
+type Message struct {
+	Id             int       `json:"id"`
+	ConversationId int       `json:"conversation_id"`
+	SenderId       int       `json:"sender_id"`
+	Body           string    `json:"body"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+type ConversationRequest struct {
+	RecipientId int `json:"recipient_id"`
+}
+
+type MessageRequest struct {
+	Body string `json:"body"`
+}
+
+type ReadReceiptRequest struct {
+	MessageId int `json:"message_id"`
+}
+
+// Notification types
+const (
+	NotificationFollow  = "follow"
+	NotificationLike    = "like"
+	NotificationReply   = "reply"
+	NotificationMention = "mention"
+	NotificationRechirp = "rechirp"
+)
+
+// Notification tells UserId that ActorId did something, possibly to or in ChirpId
+type Notification struct {
+	Id        int       `json:"id"`
+	UserId    int       `json:"user_id"`
+	Type      string    `json:"type"`
+	ActorId   int       `json:"actor_id"`
+	ChirpId   int       `json:"chirp_id,omitempty"`
+	Read      bool      `json:"read"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// UserSuggestion is an account suggested for a user to follow. MutualFollows
+// counts the accounts the user follows that already follow it.
+type UserSuggestion struct {
+	UserProfile
+	MutualFollows int     `json:"mutual_follows"`
+	Score         float64 `json:"score"`
+}
+
+// List is a named set of accounts curated by its owner. Private lists are
+// only visible to their owner.
+type List struct {
+	Id        int       `json:"id"`
+	OwnerId   int       `json:"owner_id"`
+	Name      string    `json:"name"`
+	Private   bool      `json:"private"`
+	MemberIds []int     `json:"member_ids"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// VisibleTo reports whether userId may see the list
+func (l List) VisibleTo(userId int) bool {
+	return !l.Private || l.OwnerId == userId
+}
+
+type ListRequest struct {
+	Name    string `json:"name"`
+	Private bool   `json:"private"`
+}
+
+// Relations are a user's edges to other users, each as a set of user ids,
+// and the set of groups they belong to
+type Relations struct {
+	Following map[int]bool
+	Blocked   map[int]bool
+	BlockedBy map[int]bool
+	Muted     map[int]bool
+	Groups    map[int]bool
+}
+
+// Group roles
+const (
+	GroupRoleOwner     = "owner"
+	GroupRoleModerator = "moderator"
+	GroupRoleMember    = "member"
+)
+
+// Group is a community users can join and post chirps into. MemberCount is
+// filled in when the group is read.
+type Group struct {
+	Id          int       `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	OwnerId     int       `json:"owner_id"`
+	MemberCount int       `json:"member_count"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type GroupMember struct {
+	UserId   int       `json:"user_id"`
+	Role     string    `json:"role"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+// CanModerate reports whether the member may remove chirps and members of the group
+func (m GroupMember) CanModerate() bool {
+	return m.Role == GroupRoleOwner || m.Role == GroupRoleModerator
+}
+
+type GroupRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type GroupRoleRequest struct {
+	Role string `json:"role"`
+}
+
+// UserProfile is the public view of a user. It never includes the email,
+// password or tokens.
+type UserProfile struct {
+	Id             int    `json:"id"`
+	Handle         string `json:"handle"`
+	DisplayName    string `json:"display_name"`
+	Bio            string `json:"bio"`
+	AvatarURL      string `json:"avatar_url"`
+	FollowerCount  int    `json:"follower_count"`
+	FollowingCount int    `json:"following_count"`
+}
+
+// ProfileRequest updates the fields that are present
+type ProfileRequest struct {
+	Handle      *string `json:"handle"`
+	DisplayName *string `json:"display_name"`
+	Bio         *string `json:"bio"`
+	AvatarURL   *string `json:"avatar_url"`
 }
 
 type UserRequest struct {
 	Password         string `json:"password"`
 	Email            string `json:"email"`
+	Handle           string `json:"handle,omitempty"`
 	ExpiresInSeconds int    `json:"expires_in_seconds"`
+	// DeviceLabel names the session a login starts, e.g. "Work laptop"
+	DeviceLabel string `json:"device_label,omitempty"`
 }
 
 type UpdateUserRequest struct {
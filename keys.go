@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	. "github.com/mohamed2394/goserver/internal"
+	"github.com/mohamed2394/goserver/internal/auth"
+)
+
+const (
+	// keyCheckInterval is how often the rotator checks the age of the active key
+	keyCheckInterval = time.Hour
+	// jwksMaxAge is how long other services may cache our JWKS
+	jwksMaxAge = time.Hour
+)
+
+// keyRotator replaces the active signing key once it is older than period.
+// The next key is published jwksMaxAge before it starts signing, so services
+// caching our JWKS already have it when they meet the first token it signed.
+// Replaced keys are kept for overlap so tokens they signed stay verifiable.
+type keyRotator struct {
+	keys    *auth.KeyRing
+	period  time.Duration
+	overlap time.Duration
+	done    chan struct{}
+}
+
+// newKeyRotator returns a rotator for keys. The overlap is at least
+// tokenTTL, the longest lifetime of a token signed by a key.
+func newKeyRotator(keys *auth.KeyRing, period, overlap, tokenTTL time.Duration) *keyRotator {
+	return &keyRotator{
+		keys:    keys,
+		period:  period,
+		overlap: max(overlap, tokenTTL),
+		done:    make(chan struct{}),
+	}
+}
+
+// Start runs the rotator in the background until ctx is cancelled
+func (kr *keyRotator) Start(ctx context.Context) {
+	go kr.run(ctx)
+}
+
+// Done is closed once the rotator has stopped
+func (kr *keyRotator) Done() <-chan struct{} {
+	return kr.done
+}
+
+func (kr *keyRotator) run(ctx context.Context) {
+	defer close(kr.done)
+
+	ticker := time.NewTicker(keyCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		kr.rotate(time.Now())
+
+		select {
+		case <-ctx.Done():
+			log.Println("Key rotator stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (kr *keyRotator) rotate(now time.Time) {
+	due := kr.keys.ActiveAt(now).ActivatesAt.Add(kr.period - jwksMaxAge)
+	if kr.keys.Pending(now) == nil && !now.Before(due) {
+		key, err := kr.keys.Rotate(now, jwksMaxAge)
+		if err != nil {
+			log.Printf("Failed to rotate signing key: %v", err)
+		} else {
+			log.Printf("Published signing key %s, signing from %s", key.Id, key.ActivatesAt.Format(time.RFC3339))
+		}
+	}
+	if err := kr.keys.Prune(now, kr.overlap); err != nil {
+		log.Printf("Failed to prune signing keys: %v", err)
+	}
+}
+
+// jwksHandler publishes the public signing keys so other services can verify
+// access tokens without holding a private key
+func jwksHandler(keys *auth.KeyRing) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(jwksMaxAge.Seconds())))
+		RespondWithJSON(w, http.StatusOK, keys.JWKS())
+	}
+}
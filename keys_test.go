@@ -0,0 +1,51 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mohamed2394/goserver/internal/auth"
+)
+
+func TestKeyRotatorPublishesAheadOfActivation(t *testing.T) {
+	keys, err := auth.LoadKeyRing(t.TempDir(), auth.AlgEdDSA)
+	if err != nil {
+		t.Fatalf("LoadKeyRing: %v", err)
+	}
+	const period = 24 * time.Hour
+	rotator := newKeyRotator(keys, period, time.Hour, time.Hour)
+	current := keys.Active()
+
+	// Not due yet
+	rotator.rotate(current.ActivatesAt.Add(period - jwksMaxAge - time.Minute))
+	if n := len(keys.JWKS().Keys); n != 1 {
+		t.Fatalf("%d keys before rotation is due, want 1", n)
+	}
+
+	// Due: the next key is published a JWKS cache lifetime before it signs
+	due := current.ActivatesAt.Add(period - jwksMaxAge)
+	rotator.rotate(due)
+	next := keys.Pending(due)
+	if next == nil {
+		t.Fatal("no pending key once rotation is due")
+	}
+	if want := due.UTC().Truncate(time.Second).Add(jwksMaxAge); !next.ActivatesAt.Equal(want) {
+		t.Errorf("next key activates at %s, want %s", next.ActivatesAt, want)
+	}
+
+	// Only one key is pending at a time, and the next rotation is a whole
+	// period after it activates
+	rotator.rotate(due.Add(jwksMaxAge / 2))
+	if n := len(keys.JWKS().Keys); n != 2 {
+		t.Errorf("%d keys while one is pending, want 2", n)
+	}
+	for _, now := range []time.Time{next.ActivatesAt, next.ActivatesAt.Add(period - jwksMaxAge - time.Minute)} {
+		rotator.rotate(now)
+		if pending := keys.Pending(now); pending != nil {
+			t.Errorf("key %s published at %s, before rotation is due", pending.Id, now)
+		}
+		if active := keys.ActiveAt(now); active.Id != next.Id {
+			t.Errorf("active key at %s = %s, want %s", now, active.Id, next.Id)
+		}
+	}
+}
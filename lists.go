@@ -0,0 +1,230 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	. "github.com/mohamed2394/goserver/internal"
+	. "github.com/mohamed2394/goserver/internal/database"
+)
+
+// maxListNameLength is the longest list name, in bytes
+const maxListNameLength = 50
+
+type listHandler struct {
+	db     *DB
+	apiCfg *apiConfig
+}
+
+// parseListRequest decodes and validates the body of a list create or update
+func parseListRequest(r *http.Request) (ListRequest, error) {
+	var reqBody ListRequest
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		return ListRequest{}, errors.New("Invalid JSON")
+	}
+	reqBody.Name = strings.TrimSpace(reqBody.Name)
+	if reqBody.Name == "" {
+		return ListRequest{}, errors.New("List name is required")
+	}
+	if len(reqBody.Name) > maxListNameLength {
+		return ListRequest{}, fmt.Errorf("List name must be at most %d characters", maxListNameLength)
+	}
+	return reqBody, nil
+}
+
+func (lh *listHandler) createListHandler(w http.ResponseWriter, r *http.Request) {
+	userId := currentUserId(r)
+
+	reqBody, err := parseListRequest(r)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	list, err := lh.db.CreateList(userId, reqBody.Name, reqBody.Private)
+	if err != nil {
+		log.Printf("Failed to create list: %v", err)
+		RespondWithError(w, http.StatusInternalServerError, "Failed to create list")
+		return
+	}
+
+	RespondWithJSON(w, http.StatusCreated, list)
+}
+
+func (lh *listHandler) getListsHandler(w http.ResponseWriter, r *http.Request) {
+	userId := currentUserId(r)
+	lh.respondWithLists(w, r, userId, userId)
+}
+
+// getUserListsHandler lists the lists of the user in the path, leaving out
+// private ones unless the viewer owns them
+func (lh *listHandler) getUserListsHandler(w http.ResponseWriter, r *http.Request) {
+	viewerId := currentUserId(r)
+	ownerId, err := strconv.Atoi(r.PathValue("USERID"))
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	lh.respondWithLists(w, r, ownerId, viewerId)
+}
+
+func (lh *listHandler) respondWithLists(w http.ResponseWriter, r *http.Request, ownerId, viewerId int) {
+	page, err := parsePage(r)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	lists, err := lh.db.GetLists(ownerId, viewerId)
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to load lists")
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, paginate(lists, page))
+}
+
+func (lh *listHandler) getListHandler(w http.ResponseWriter, r *http.Request) {
+	viewerId := currentUserId(r)
+	id, err := strconv.Atoi(r.PathValue("LISTID"))
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid list ID")
+		return
+	}
+
+	list, err := lh.db.GetList(id, viewerId)
+	if errors.Is(err, ErrNotFound) {
+		RespondWithError(w, http.StatusNotFound, "List not found")
+		return
+	}
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to load list")
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, list)
+}
+
+func (lh *listHandler) updateListHandler(w http.ResponseWriter, r *http.Request) {
+	userId := currentUserId(r)
+	id, err := strconv.Atoi(r.PathValue("LISTID"))
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid list ID")
+		return
+	}
+
+	reqBody, err := parseListRequest(r)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	list, err := lh.db.UpdateList(id, userId, reqBody.Name, reqBody.Private)
+	if errors.Is(err, ErrNotFound) {
+		RespondWithError(w, http.StatusNotFound, "List not found")
+		return
+	}
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to update list")
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, list)
+}
+
+func (lh *listHandler) deleteListHandler(w http.ResponseWriter, r *http.Request) {
+	userId := currentUserId(r)
+	id, err := strconv.Atoi(r.PathValue("LISTID"))
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid list ID")
+		return
+	}
+
+	err = lh.db.DeleteList(id, userId)
+	if errors.Is(err, ErrNotFound) {
+		RespondWithError(w, http.StatusNotFound, "List not found")
+		return
+	}
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to delete list")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (lh *listHandler) addListMemberHandler(w http.ResponseWriter, r *http.Request) {
+	lh.changeMembers(w, r, lh.db.AddListMember)
+}
+
+func (lh *listHandler) removeListMemberHandler(w http.ResponseWriter, r *http.Request) {
+	lh.changeMembers(w, r, lh.db.RemoveListMember)
+}
+
+// changeMembers applies change to the list and user in the path and writes the updated list
+func (lh *listHandler) changeMembers(w http.ResponseWriter, r *http.Request, change func(id, ownerId, userId int) (List, error)) {
+	ownerId := currentUserId(r)
+	id, err := strconv.Atoi(r.PathValue("LISTID"))
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid list ID")
+		return
+	}
+	memberId, err := strconv.Atoi(r.PathValue("USERID"))
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	list, err := change(id, ownerId, memberId)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		RespondWithError(w, http.StatusNotFound, "List not found")
+	case errors.Is(err, ErrUnknownUser):
+		RespondWithError(w, http.StatusNotFound, "User not found")
+	case errors.Is(err, ErrBlocked):
+		RespondWithError(w, http.StatusForbidden, "You can't add this user")
+	case err != nil:
+		log.Printf("Failed to update list members: %v", err)
+		RespondWithError(w, http.StatusInternalServerError, "Failed to update list")
+	default:
+		RespondWithJSON(w, http.StatusOK, list)
+	}
+}
+
+// getListTimelineHandler returns the chirps of the list's members, newest
+// first, with the same limit/cursor pagination as the main chirp listing
+func (lh *listHandler) getListTimelineHandler(w http.ResponseWriter, r *http.Request) {
+	viewerId := currentUserId(r)
+	id, err := strconv.Atoi(r.PathValue("LISTID"))
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid list ID")
+		return
+	}
+	page, err := parseChirpPage(r)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	chirps, err := lh.db.GetListChirps(id, viewerId)
+	if errors.Is(err, ErrNotFound) {
+		RespondWithError(w, http.StatusNotFound, "List not found")
+		return
+	}
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to load list timeline")
+		return
+	}
+	viewer, err := newChirpViewer(lh.db, viewerId)
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to load list timeline")
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, page.applyNewestFirst(viewer.filterFeed(chirps)))
+}
@@ -1,32 +1,87 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/joho/godotenv"
 	e "github.com/mohamed2394/goserver/internal"
+	"github.com/mohamed2394/goserver/internal/auth"
 	d "github.com/mohamed2394/goserver/internal/database"
+	"github.com/mohamed2394/goserver/internal/mail"
 )
 
 func main() {
 	const port = "8080"
 
+	// by default, godotenv will look for a file named .env in the current directory
+	if err := godotenv.Load(); err != nil {
+		log.Fatal("Error loading .env file")
+	}
+
 	// Set up database
 	dbPath := "internal/database/database.json"
 	db, err := d.NewDB(dbPath)
 	if err != nil {
 		log.Fatalf("Failed to set up database: %v\n", err)
 	}
-	defer os.Remove(dbPath) // Ensure the database file is deleted on exit
 
-	// by default, godotenv will look for a file named .env in the current directory
+	// Deliver new chirps to home timelines and notify mentioned users
+	events := &chirpEvents{}
+	timeline := &homeTimeline{db: db}
+	events.Subscribe(timeline.onChirpEvent)
+	notifier := &notifier{db: db}
+	events.Subscribe(notifier.onChirpEvent)
+
+	// Start the publisher for scheduled chirps; pending ones are reloaded from the database
+	ctx, cancel := context.WithCancel(context.Background())
+	scheduler := newChirpScheduler(db, events)
+	if err := scheduler.Start(ctx); err != nil {
+		log.Fatalf("Failed to start chirp scheduler: %v\n", err)
+	}
+
+	// Purge expired ephemeral chirps in the background
+	reaper := newChirpReaper(db, events)
+	reaper.Start(ctx)
+
+	// Keep "who to follow" suggestions fresh for users who ask for them
+	suggestions := newSuggestionCache(db)
+	suggestions.Start(ctx)
+
+	// Token lifetimes; clients may ask for access tokens of up to MaxAccess
+	ttls := tokenLifetimes{
+		Access:    envDuration("JWT_ACCESS_TTL", time.Hour),
+		MaxAccess: envDuration("JWT_MAX_ACCESS_TTL", 24*time.Hour),
+		Refresh:   envDuration("REFRESH_TOKEN_TTL", 60*24*time.Hour),
+	}
+	if ttls.Access <= 0 || ttls.Refresh <= 0 {
+		log.Fatal("Token lifetimes must be positive")
+	}
+	ttls.MaxAccess = max(ttls.MaxAccess, ttls.Access)
+
+	// Load the token signing keys and rotate them in the background
+	keys, err := auth.LoadKeyRing(envOrDefault("JWT_KEYS_DIR", "keys"), envOrDefault("JWT_SIGNING_ALG", auth.AlgEdDSA))
+	if err != nil {
+		log.Fatalf("Failed to load signing keys: %v\n", err)
+	}
+	rotator := newKeyRotator(keys, envDuration("JWT_KEY_ROTATION", 30*24*time.Hour), envDuration("JWT_KEY_OVERLAP", 24*time.Hour), ttls.MaxAccess)
+	rotator.Start(ctx)
+
+	mailer, err := newMailer()
+	if err != nil {
+		log.Fatalf("Failed to set up mailer: %v\n", err)
+	}
+
 	// Set up server and routes
 	mux := http.NewServeMux()
-	setupRoutes(mux, db)
+	setupRoutes(mux, db, scheduler, events, notifier, suggestions, keys, ttls, mailer)
 
 	srv := &http.Server{
 		Addr:    ":" + port,
@@ -50,55 +105,264 @@ func main() {
 	if err := srv.Close(); err != nil {
 		log.Fatalf("Server Close: %v\n", err)
 	}
+
+	// Stop background workers
+	cancel()
+	<-scheduler.Done()
+	<-reaper.Done()
+	<-suggestions.Done()
+	<-rotator.Done()
 }
-func setupRoutes(mux *http.ServeMux, db *d.DB) {
-	errV := godotenv.Load()
-	if errV != nil {
-		log.Fatal("Error loading .env file")
-	}
+func setupRoutes(mux *http.ServeMux, db *d.DB, scheduler *chirpScheduler, events *chirpEvents, notifier *notifier, suggestions *suggestionCache, keys *auth.KeyRing, ttls tokenLifetimes, mailer mail.Mailer) {
+	// Access tokens are bound to this issuer and audience; the leeway
+	// absorbs clock skew between the machines issuing and checking them
+	issuer := envOrDefault("JWT_ISSUER", "chirpy")
+	audience := envOrDefault("JWT_AUDIENCE", "chirpy")
+	leeway := envDuration("JWT_LEEWAY", 30*time.Second)
 
-	secretKey := os.Getenv("JWT_SECRET")
+	revocations, err := newTokenRevocations(db, leeway)
+	if err != nil {
+		log.Fatalf("Failed to load revoked tokens: %v\n", err)
+	}
 
 	const filepathRoot = "."
 	apiCfg := &apiConfig{
 		fileserverHits: 0,
-		secretKey:      secretKey,
+		issuer:         auth.NewIssuer(keys, issuer, audience),
+		verifier:       auth.NewVerifier(keys, issuer, audience, leeway),
+		revocations:    revocations,
+		ttls:           ttls,
+
+		// Off by default; accounts older than email verification can
+		// always post, everyone else has to verify first
+		requireVerifiedEmail: envBool("REQUIRE_VERIFIED_EMAIL", false),
 	}
 
 	chirpH := chirpHandler{
+		db:        db,
+		apiCfg:    apiCfg,
+		scheduler: scheduler,
+		events:    events,
+	}
+
+	userH := userHandler{
+		db:        db,
+		apiCfg:    apiCfg,
+		notifier:  notifier,
+		mailer:    mailer,
+		publicURL: strings.TrimSuffix(envOrDefault("PUBLIC_URL", "http://localhost:8080"), "/"),
+	}
+
+	conversationH := conversationHandler{
 		db:     db,
 		apiCfg: apiCfg,
 	}
 
-	userH := userHandler{
+	notificationH := notificationHandler{
+		db:     db,
+		apiCfg: apiCfg,
+	}
+
+	listH := listHandler{
+		db:     db,
+		apiCfg: apiCfg,
+	}
+
+	suggestionH := suggestionHandler{
+		db:          db,
+		apiCfg:      apiCfg,
+		suggestions: suggestions,
+	}
+
+	groupH := groupHandler{
 		db:     db,
 		apiCfg: apiCfg,
 	}
 
+	// Handlers behind requireAuth and optionalAuth read the authenticated
+	// user from the request context
+	requireAuth := apiCfg.RequireAuth
+	optionalAuth := apiCfg.OptionalAuth
+
 	handler := http.FileServer(http.Dir(filepathRoot))
 	mux.Handle("/app/", http.StripPrefix("/app/", apiCfg.middlewareMetricsInc(handler)))
 
 	mux.Handle("/api/healthz", &readinessHandler{})
+	mux.HandleFunc("GET /.well-known/jwks.json", jwksHandler(keys))
 	mux.HandleFunc("/admin/metrics", apiCfg.metricsHandler)
 	mux.HandleFunc("/api/reset", apiCfg.resetHandler)
 	mux.HandleFunc("POST /api/users", userH.createUserHandler)
 	mux.HandleFunc("POST /api/login", userH.loginUserHandler)
-	mux.HandleFunc("PUT /api/users", userH.updateUserHandler)
+	mux.HandleFunc("POST /api/login/2fa", userH.loginTwoFactorHandler)
+	mux.HandleFunc("GET /api/2fa", requireAuth(userH.getTwoFactorHandler))
+	mux.HandleFunc("POST /api/2fa/setup", requireAuth(userH.setupTwoFactorHandler))
+	mux.HandleFunc("POST /api/2fa/confirm", requireAuth(userH.confirmTwoFactorHandler))
+	mux.HandleFunc("DELETE /api/2fa", requireAuth(userH.disableTwoFactorHandler))
+	mux.HandleFunc("PUT /api/users", requireAuth(userH.updateUserHandler))
+	mux.HandleFunc("POST /api/users/verify", userH.verifyEmailHandler)
+	mux.HandleFunc("POST /api/users/verify/resend", requireAuth(userH.resendVerificationHandler))
 	mux.HandleFunc("POST /api/refresh", userH.refreshToken)
 	mux.HandleFunc("POST /api/revoke", userH.revokeToken)
+	mux.HandleFunc("POST /api/logout", requireAuth(userH.logoutHandler))
+	mux.HandleFunc("GET /api/sessions", requireAuth(userH.getSessionsHandler))
+	mux.HandleFunc("DELETE /api/sessions", requireAuth(userH.deleteAllSessionsHandler))
+	mux.HandleFunc("DELETE /api/sessions/{SESSIONID}", requireAuth(userH.deleteSessionHandler))
+	mux.HandleFunc("GET /api/security-events", requireAuth(userH.getSecurityEventsHandler))
+	mux.HandleFunc("POST /api/password-reset", userH.requestPasswordResetHandler)
+	mux.HandleFunc("POST /api/password-reset/confirm", userH.confirmPasswordResetHandler)
+
+	mux.HandleFunc("GET /api/chirps/{CHIRPID}", optionalAuth(chirpH.getChirpByIdHandler))
+	mux.HandleFunc("GET /api/chirps/scheduled", requireAuth(chirpH.getScheduledChirpsHandler))
+	// Alias of DELETE /api/chirps/scheduled/{CHIRPID}, routed below
+	mux.HandleFunc("DELETE /api/scheduled-chirps/{CHIRPID}", requireAuth(chirpH.cancelScheduledChirpHandler))
+
+	mux.HandleFunc("DELETE /api/chirps/{CHIRPID}", requireAuth(chirpH.deleteChirpHandler))
+	mux.HandleFunc("POST /api/chirps/{CHIRPID}/votes", requireAuth(chirpH.votePollHandler))
+	mux.HandleFunc("POST /api/chirps/{CHIRPID}/bookmark", requireAuth(chirpH.bookmarkChirpHandler))
+	// DELETE /api/chirps/scheduled/{CHIRPID} has the same shape as the
+	// per-chirp removals, so all share one pattern and are told apart here
+	mux.HandleFunc("DELETE /api/chirps/{CHIRPID}/{ACTION}", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("CHIRPID") == "scheduled" {
+			r.SetPathValue("CHIRPID", r.PathValue("ACTION"))
+			requireAuth(chirpH.cancelScheduledChirpHandler)(w, r)
+			return
+		}
+		switch r.PathValue("ACTION") {
+		case "bookmark":
+			requireAuth(chirpH.unbookmarkChirpHandler)(w, r)
+		case "pin":
+			requireAuth(chirpH.unpinChirpHandler)(w, r)
+		default:
+			e.RespondWithError(w, http.StatusNotFound, "Not found")
+		}
+	})
+	mux.HandleFunc("GET /api/bookmarks", requireAuth(chirpH.getBookmarksHandler))
+	mux.HandleFunc("GET /api/timeline", requireAuth(chirpH.getTimelineHandler))
+	mux.HandleFunc("POST /api/chirps/{CHIRPID}/pin", requireAuth(chirpH.pinChirpHandler))
+	mux.HandleFunc("GET /api/users/{USERID}", userH.getUserProfileHandler)
+	mux.HandleFunc("PUT /api/users/profile", requireAuth(userH.updateProfileHandler))
+	mux.HandleFunc("POST /api/users/{USERID}/follow", requireAuth(userH.followUserHandler))
+	mux.HandleFunc("DELETE /api/users/{USERID}/follow", requireAuth(userH.unfollowUserHandler))
+	// GET /api/users/by-handle/{HANDLE} has the same shape as the per-user
+	// listings, so both share one pattern and are told apart here
+	mux.HandleFunc("GET /api/users/{USERID}/{RESOURCE}", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("USERID") == "by-handle" {
+			r.SetPathValue("HANDLE", r.PathValue("RESOURCE"))
+			userH.getUserByHandleHandler(w, r)
+			return
+		}
+		switch r.PathValue("RESOURCE") {
+		case "chirps":
+			optionalAuth(chirpH.getUserChirpsHandler)(w, r)
+		case "followers":
+			userH.getFollowersHandler(w, r)
+		case "following":
+			userH.getFollowingHandler(w, r)
+		case "lists":
+			optionalAuth(listH.getUserListsHandler)(w, r)
+		default:
+			e.RespondWithError(w, http.StatusNotFound, "Not found")
+		}
+	})
+	mux.HandleFunc("POST /api/users/{USERID}/block", requireAuth(userH.blockUserHandler))
+	mux.HandleFunc("DELETE /api/users/{USERID}/block", requireAuth(userH.unblockUserHandler))
+	mux.HandleFunc("POST /api/users/{USERID}/mute", requireAuth(userH.muteUserHandler))
+	mux.HandleFunc("DELETE /api/users/{USERID}/mute", requireAuth(userH.unmuteUserHandler))
+
+	mux.HandleFunc("POST /api/drafts", requireAuth(chirpH.createDraftHandler))
+	mux.HandleFunc("GET /api/drafts", requireAuth(chirpH.getDraftsHandler))
+	mux.HandleFunc("PUT /api/drafts/{DRAFTID}", requireAuth(chirpH.updateDraftHandler))
+	mux.HandleFunc("DELETE /api/drafts/{DRAFTID}", requireAuth(chirpH.deleteDraftHandler))
+	mux.HandleFunc("POST /api/drafts/{DRAFTID}/publish", requireAuth(chirpH.publishDraftHandler))
+
+	mux.HandleFunc("POST /api/conversations", requireAuth(conversationH.createConversationHandler))
+	mux.HandleFunc("GET /api/conversations", requireAuth(conversationH.getConversationsHandler))
+	mux.HandleFunc("GET /api/conversations/{CONVERSATIONID}", requireAuth(conversationH.getConversationHandler))
+	mux.HandleFunc("GET /api/conversations/{CONVERSATIONID}/messages", requireAuth(conversationH.getMessagesHandler))
+	mux.HandleFunc("POST /api/conversations/{CONVERSATIONID}/messages", requireAuth(conversationH.postMessageHandler))
+	mux.HandleFunc("POST /api/conversations/{CONVERSATIONID}/read", requireAuth(conversationH.markReadHandler))
 
-	mux.HandleFunc("GET /api/chirps/{CHIRPID}", chirpH.getChirpByIdHandler)
+	mux.HandleFunc("GET /api/notifications", requireAuth(notificationH.getNotificationsHandler))
+	mux.HandleFunc("GET /api/notifications/unread-count", requireAuth(notificationH.getUnreadCountHandler))
+	mux.HandleFunc("POST /api/notifications/{NOTIFICATIONID}/read", requireAuth(notificationH.markReadHandler))
+	mux.HandleFunc("POST /api/notifications/read-all", requireAuth(notificationH.markAllReadHandler))
 
-	mux.HandleFunc("DELETE /api/chirps/{CHIRPID}", chirpH.deleteChirpHandler)
+	mux.HandleFunc("POST /api/lists", requireAuth(listH.createListHandler))
+	mux.HandleFunc("GET /api/lists", requireAuth(listH.getListsHandler))
+	mux.HandleFunc("GET /api/lists/{LISTID}", optionalAuth(listH.getListHandler))
+	mux.HandleFunc("PUT /api/lists/{LISTID}", requireAuth(listH.updateListHandler))
+	mux.HandleFunc("DELETE /api/lists/{LISTID}", requireAuth(listH.deleteListHandler))
+	mux.HandleFunc("PUT /api/lists/{LISTID}/members/{USERID}", requireAuth(listH.addListMemberHandler))
+	mux.HandleFunc("DELETE /api/lists/{LISTID}/members/{USERID}", requireAuth(listH.removeListMemberHandler))
+	mux.HandleFunc("GET /api/lists/{LISTID}/timeline", optionalAuth(listH.getListTimelineHandler))
+
+	mux.HandleFunc("GET /api/suggestions/users", requireAuth(suggestionH.getUserSuggestionsHandler))
+
+	mux.HandleFunc("POST /api/groups", requireAuth(groupH.createGroupHandler))
+	mux.HandleFunc("GET /api/groups", groupH.getGroupsHandler)
+	mux.HandleFunc("GET /api/groups/{GROUPID}", groupH.getGroupHandler)
+	mux.HandleFunc("GET /api/groups/{GROUPID}/chirps", optionalAuth(groupH.getGroupChirpsHandler))
+	mux.HandleFunc("GET /api/groups/{GROUPID}/members", groupH.getGroupMembersHandler)
+	mux.HandleFunc("POST /api/groups/{GROUPID}/members", requireAuth(groupH.joinGroupHandler))
+	mux.HandleFunc("PUT /api/groups/{GROUPID}/members/{USERID}", requireAuth(groupH.setGroupRoleHandler))
+	mux.HandleFunc("DELETE /api/groups/{GROUPID}/members/{USERID}", requireAuth(groupH.removeGroupMemberHandler))
 
 	mux.HandleFunc("/api/chirps", func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodPost:
-			chirpH.postChirpsHandler(w, r)
+			requireAuth(chirpH.postChirpsHandler)(w, r)
 		case http.MethodGet:
-			chirpH.getChirpsHandler(w, r)
+			optionalAuth(chirpH.getChirpsHandler)(w, r)
 		default:
 			e.RespondWithError(w, http.StatusMethodNotAllowed, "Method not allowed")
 		}
 	})
 }
+
+// newMailer returns an SMTP mailer if SMTP_ADDR is set, and otherwise one
+// that writes messages to MAIL_OUTBOX_DIR
+func newMailer() (mail.Mailer, error) {
+	from := envOrDefault("MAIL_FROM", "Chirpy <no-reply@localhost>")
+	if addr := os.Getenv("SMTP_ADDR"); addr != "" {
+		return mail.NewSMTPMailer(addr, from, os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"))
+	}
+	dir := envOrDefault("MAIL_OUTBOX_DIR", "outbox")
+	log.Printf("SMTP_ADDR is not set, writing emails to %s\n", dir)
+	return mail.NewOutboxMailer(dir, from)
+}
+
+// envOrDefault returns the environment variable key, or def if it is unset or empty
+func envOrDefault(key, def string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return def
+}
+
+// envBool parses the environment variable key as a bool, or returns def if
+// it is unset
+func envBool(key string, def bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Fatalf("Invalid %s: %v", key, err)
+	}
+	return b
+}
+
+// envDuration parses the environment variable key as a time.Duration, or
+// returns def if it is unset
+func envDuration(key string, def time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatalf("Invalid %s: %v", key, err)
+	}
+	return duration
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mohamed2394/goserver/internal/auth"
+	d "github.com/mohamed2394/goserver/internal/database"
+	"github.com/mohamed2394/goserver/internal/mail"
+)
+
+// testServer is the full set of routes over a fresh database, key ring and
+// mail outbox in a temporary directory
+type testServer struct {
+	mux    *http.ServeMux
+	db     *d.DB
+	outbox string
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	dir := t.TempDir()
+
+	db, err := d.NewDB(filepath.Join(dir, "database.json"))
+	if err != nil {
+		t.Fatalf("NewDB: %v", err)
+	}
+	keys, err := auth.LoadKeyRing(filepath.Join(dir, "keys"), auth.AlgEdDSA)
+	if err != nil {
+		t.Fatalf("LoadKeyRing: %v", err)
+	}
+	outbox := filepath.Join(dir, "outbox")
+	mailer, err := mail.NewOutboxMailer(outbox, "Chirpy <no-reply@localhost>")
+	if err != nil {
+		t.Fatalf("NewOutboxMailer: %v", err)
+	}
+
+	events := &chirpEvents{}
+	ttls := tokenLifetimes{Access: time.Hour, MaxAccess: 24 * time.Hour, Refresh: 24 * time.Hour}
+	mux := http.NewServeMux()
+	setupRoutes(mux, db, newChirpScheduler(db, events), events, &notifier{db: db}, newSuggestionCache(db), keys, ttls, mailer)
+	return &testServer{mux: mux, db: db, outbox: outbox}
+}
+
+// do sends a request with the bearer token, if any, and JSON body, if any
+func (ts *testServer) do(t *testing.T, method, path, token string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+	var encoded []byte
+	if body != nil {
+		var err error
+		if encoded, err = json.Marshal(body); err != nil {
+			t.Fatalf("encoding request body: %v", err)
+		}
+	}
+
+	r := httptest.NewRequest(method, path, bytes.NewReader(encoded))
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	ts.mux.ServeHTTP(w, r)
+	return w
+}
+
+// testLogin is the part of a login response the tests use
+type testLogin struct {
+	Id           int    `json:"id"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// login logs in as email, failing the test unless it succeeds
+func (ts *testServer) login(t *testing.T, email, password string) testLogin {
+	t.Helper()
+	w := ts.do(t, http.MethodPost, "/api/login", "", map[string]string{"email": email, "password": password})
+	if w.Code != http.StatusOK {
+		t.Fatalf("login as %s: %d %s", email, w.Code, w.Body)
+	}
+	var login testLogin
+	if err := json.NewDecoder(w.Body).Decode(&login); err != nil {
+		t.Fatalf("decoding login: %v", err)
+	}
+	return login
+}
+
+// signup creates a user and logs them in
+func (ts *testServer) signup(t *testing.T, email, password string) testLogin {
+	t.Helper()
+	w := ts.do(t, http.MethodPost, "/api/users", "", map[string]string{"email": email, "password": password})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("signup as %s: %d %s", email, w.Code, w.Body)
+	}
+	return ts.login(t, email, password)
+}
+
+// waitForMail returns the body of the first message in the outbox whose
+// subject is subject and that is not in seen, waiting for it to be written
+func (ts *testServer) waitForMail(t *testing.T, subject string, seen map[string]bool) string {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		entries, _ := os.ReadDir(ts.outbox)
+		for _, entry := range entries {
+			if seen[entry.Name()] {
+				continue
+			}
+			b, err := os.ReadFile(filepath.Join(ts.outbox, entry.Name()))
+			if err != nil {
+				continue
+			}
+			if strings.Contains(string(b), "\r\nSubject: "+subject+"\r\n") {
+				seen[entry.Name()] = true
+				return string(b)
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("no %q email in the outbox", subject)
+	return ""
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	. "github.com/mohamed2394/goserver/internal"
+	. "github.com/mohamed2394/goserver/internal/database"
+)
+
+var mentionPattern = regexp.MustCompile(`(?:^|[^A-Za-z0-9_])@([A-Za-z0-9_]{3,15})\b`)
+
+// notifier turns follows and chirp events into notifications
+type notifier struct {
+	db *DB
+}
+
+// onChirpEvent is subscribed to the chirp event bus
+func (n *notifier) onChirpEvent(event chirpEvent) {
+	if event.Type == chirpCreated {
+		n.notifyMentions(event.Chirp)
+	}
+}
+
+func (n *notifier) notifyFollow(followerId, followeeId int) {
+	err := n.db.CreateNotifications([]Notification{{
+		UserId:  followeeId,
+		Type:    NotificationFollow,
+		ActorId: followerId,
+	}})
+	if err != nil {
+		log.Printf("Failed to notify user %d of new follower: %v", followeeId, err)
+	}
+}
+
+// notifyMentions notifies the users mentioned by @handle in a chirp. Users who
+// can't read the chirp, including anyone on either side of a block with the
+// author, are skipped.
+func (n *notifier) notifyMentions(chirp Chirp) {
+	var handles []string
+	for _, match := range mentionPattern.FindAllStringSubmatch(chirp.Body, -1) {
+		handles = append(handles, match[1])
+	}
+	if len(handles) == 0 {
+		return
+	}
+
+	userIds, err := n.db.GetUserIdsByHandles(handles)
+	if err != nil {
+		log.Printf("Failed to resolve mentions in chirp %d: %v", chirp.Id, err)
+		return
+	}
+
+	var notifications []Notification
+	for _, userId := range userIds {
+		if userId == chirp.AuthorId {
+			continue
+		}
+		viewer, err := newChirpViewer(n.db, userId)
+		if err != nil {
+			log.Printf("Failed to load relations of user %d: %v", userId, err)
+			continue
+		}
+		if !viewer.canSee(chirp) || viewer.relations.Blocked[chirp.AuthorId] {
+			continue
+		}
+		notifications = append(notifications, Notification{
+			UserId:  userId,
+			Type:    NotificationMention,
+			ActorId: chirp.AuthorId,
+			ChirpId: chirp.Id,
+		})
+	}
+
+	if err := n.db.CreateNotifications(notifications); err != nil {
+		log.Printf("Failed to notify mentions in chirp %d: %v", chirp.Id, err)
+	}
+}
+
+type notificationHandler struct {
+	db     *DB
+	apiCfg *apiConfig
+}
+
+func (nh *notificationHandler) getNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	userId := currentUserId(r)
+	page, err := parsePage(r)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	unreadOnly := r.URL.Query().Get("unread") == "true"
+	notifications, err := nh.db.GetNotifications(userId, unreadOnly)
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to load notifications")
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, paginate(notifications, page))
+}
+
+func (nh *notificationHandler) getUnreadCountHandler(w http.ResponseWriter, r *http.Request) {
+	userId := currentUserId(r)
+
+	count, err := nh.db.GetUnreadNotificationCount(userId)
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to load notifications")
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"unread_count": count,
+	})
+}
+
+func (nh *notificationHandler) markReadHandler(w http.ResponseWriter, r *http.Request) {
+	userId := currentUserId(r)
+	id, err := strconv.Atoi(r.PathValue("NOTIFICATIONID"))
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid notification ID")
+		return
+	}
+
+	err = nh.db.MarkNotificationRead(id, userId)
+	if errors.Is(err, ErrNotFound) {
+		RespondWithError(w, http.StatusNotFound, "Notification not found")
+		return
+	}
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to update notification")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (nh *notificationHandler) markAllReadHandler(w http.ResponseWriter, r *http.Request) {
+	userId := currentUserId(r)
+
+	if err := nh.db.MarkAllNotificationsRead(userId); err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to update notifications")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
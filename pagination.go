@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+
+	. "github.com/mohamed2394/goserver/internal"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// pageParams are the limit and offset query parameters of a paginated listing
+type pageParams struct {
+	limit  int
+	offset int
+}
+
+// parsePage reads ?limit= and ?offset= from the request
+func parsePage(r *http.Request) (pageParams, error) {
+	page := pageParams{limit: defaultPageSize}
+
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 {
+			return pageParams{}, errors.New("Invalid limit")
+		}
+		page.limit = min(limit, maxPageSize)
+	}
+	if raw := r.URL.Query().Get("offset"); raw != "" {
+		offset, err := strconv.Atoi(raw)
+		if err != nil || offset < 0 {
+			return pageParams{}, errors.New("Invalid offset")
+		}
+		page.offset = offset
+	}
+	return page, nil
+}
+
+// paginate returns the slice of items selected by page
+func paginate[T any](items []T, page pageParams) []T {
+	if page.offset >= len(items) {
+		return []T{}
+	}
+	end := min(page.offset+page.limit, len(items))
+	return items[page.offset:end]
+}
+
+// chirpPage is the cursor pagination of chirp and message streams: ?limit=
+// and ?cursor=, where cursor is the id of the last item of the previous page
+type chirpPage struct {
+	limit  int
+	cursor int
+}
+
+// parseChirpPage reads ?limit= and ?cursor= from the request
+func parseChirpPage(r *http.Request) (chirpPage, error) {
+	page := chirpPage{limit: defaultPageSize}
+
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 {
+			return chirpPage{}, errors.New("Invalid limit")
+		}
+		page.limit = min(limit, maxPageSize)
+	}
+	if raw := r.URL.Query().Get("cursor"); raw != "" {
+		cursor, err := strconv.Atoi(raw)
+		if err != nil || cursor < 1 {
+			return chirpPage{}, errors.New("Invalid cursor")
+		}
+		page.cursor = cursor
+	}
+	return page, nil
+}
+
+// applyNewestFirst returns the page of chirps, which must be sorted newest first
+func (page chirpPage) applyNewestFirst(chirps []Chirp) []Chirp {
+	return pageNewestFirst(chirps, page, func(chirp Chirp) int { return chirp.Id })
+}
+
+// pageNewestFirst returns the page of items, which must be sorted by
+// descending id
+func pageNewestFirst[T any](items []T, page chirpPage, id func(T) int) []T {
+	start := 0
+	if page.cursor != 0 {
+		start = sort.Search(len(items), func(i int) bool { return id(items[i]) < page.cursor })
+	}
+	end := min(start+page.limit, len(items))
+	return items[start:end]
+}
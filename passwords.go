@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	. "github.com/mohamed2394/goserver/internal"
+	. "github.com/mohamed2394/goserver/internal/database"
+	"github.com/mohamed2394/goserver/internal/mail"
+)
+
+const (
+	// passwordResetTTL is how long a password reset link works
+	passwordResetTTL = 30 * time.Minute
+	// maxPasswordLength is the most bcrypt can hash, in bytes
+	maxPasswordLength = 72
+)
+
+// validatePassword checks a password chosen at signup, update or reset
+func validatePassword(password string) error {
+	if password == "" {
+		return errors.New("Password is required")
+	}
+	if len(password) > maxPasswordLength {
+		return fmt.Errorf("Password must be at most %d bytes", maxPasswordLength)
+	}
+	return nil
+}
+
+// requestPasswordResetHandler emails a reset link to the address given. The
+// response is the same whether or not the address belongs to an account, so
+// it cannot be used to find out who is registered.
+func (uh *userHandler) requestPasswordResetHandler(w http.ResponseWriter, r *http.Request) {
+	var reqBody PasswordResetRequest
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+	email, err := NormalizeEmail(reqBody.Email)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	token, err := newOpaqueToken()
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Error generating reset token")
+		return
+	}
+
+	user, err := uh.db.CreatePasswordReset(email, token, time.Now(), passwordResetTTL)
+	switch {
+	case errors.Is(err, ErrNotFound):
+	case err != nil:
+		log.Printf("Failed to create password reset: %v", err)
+	default:
+		// Sent in the background so the response takes as long either way
+		go uh.sendPasswordReset(user, token)
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (uh *userHandler) sendPasswordReset(user User, token string) {
+	link := fmt.Sprintf("%s/app/reset-password?token=%s", uh.publicURL, url.QueryEscape(token))
+	err := uh.mailer.Send(mail.Message{
+		To:      user.Email,
+		Subject: "Reset your Chirpy password",
+		Body: fmt.Sprintf("Someone asked to reset the password of your Chirpy account.\n\n"+
+			"To choose a new password, open %s\n"+
+			"or use this reset token: %s\n\n"+
+			"The link expires in %d minutes. If you did not ask for this, you can ignore this email.\n",
+			link, token, int(passwordResetTTL.Minutes())),
+	})
+	if err != nil {
+		log.Printf("Failed to send password reset to user %d: %v", user.Id, err)
+	}
+}
+
+// confirmPasswordResetHandler sets a new password with a reset token and
+// logs the user out everywhere
+func (uh *userHandler) confirmPasswordResetHandler(w http.ResponseWriter, r *http.Request) {
+	var reqBody PasswordResetConfirmRequest
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+	if reqBody.Token == "" {
+		RespondWithError(w, http.StatusBadRequest, "Token is required")
+		return
+	}
+	if err := validatePassword(reqBody.Password); err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	userId, err := uh.db.ResetPassword(reqBody.Token, reqBody.Password, time.Now())
+	if errors.Is(err, ErrNotFound) {
+		RespondWithError(w, http.StatusBadRequest, "Invalid or expired reset token")
+		return
+	}
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to reset password")
+		return
+	}
+
+	// Sessions went with the password change; access tokens still need revoking
+	if err := uh.apiCfg.revocations.RevokeAll(userId); err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to revoke tokens")
+		return
+	}
+	log.Printf("Password of user %d was reset, all sessions revoked", userId)
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+
+	d "github.com/mohamed2394/goserver/internal/database"
+)
+
+const resetSubject = "Reset your Chirpy password"
+
+var resetTokenPattern = regexp.MustCompile(`reset token: (\S+)`)
+
+// requestReset asks for a password reset of email and returns the token
+// from the email it sends
+func requestReset(t *testing.T, ts *testServer, email string, seen map[string]bool) string {
+	t.Helper()
+	w := ts.do(t, http.MethodPost, "/api/password-reset", "", map[string]string{"email": email})
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("password reset request: %d %s", w.Code, w.Body)
+	}
+	match := resetTokenPattern.FindStringSubmatch(ts.waitForMail(t, resetSubject, seen))
+	if match == nil {
+		t.Fatal("no reset token in the email")
+	}
+	return match[1]
+}
+
+func TestPasswordResetUnknownEmail(t *testing.T) {
+	ts := newTestServer(t)
+
+	w := ts.do(t, http.MethodPost, "/api/password-reset", "", map[string]string{"email": "nobody@example.com"})
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusAccepted)
+	}
+}
+
+func TestPasswordReset(t *testing.T) {
+	ts := newTestServer(t)
+	const email = "walt@example.com"
+	first := ts.signup(t, email, "old password")
+	second := ts.login(t, email, "old password")
+	seen := map[string]bool{}
+
+	token := requestReset(t, ts, email, seen)
+	w := ts.do(t, http.MethodPost, "/api/password-reset/confirm", "", map[string]string{"token": token, "password": "new password"})
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("confirm: %d %s", w.Code, w.Body)
+	}
+
+	// The token is used up
+	w = ts.do(t, http.MethodPost, "/api/password-reset/confirm", "", map[string]string{"token": token, "password": "newer password"})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("second confirm: status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+
+	// Every session and access token of the user is revoked
+	sessions, err := ts.db.GetSessions(first.Id)
+	if err != nil {
+		t.Fatalf("GetSessions: %v", err)
+	}
+	if len(sessions) != 0 {
+		t.Errorf("%d sessions left after the reset", len(sessions))
+	}
+	for _, login := range []testLogin{first, second} {
+		if w := ts.do(t, http.MethodGet, "/api/sessions", login.Token, nil); w.Code != http.StatusUnauthorized {
+			t.Errorf("access token after reset: status = %d, want %d", w.Code, http.StatusUnauthorized)
+		}
+		if w := ts.do(t, http.MethodPost, "/api/refresh", login.RefreshToken, nil); w.Code != http.StatusUnauthorized {
+			t.Errorf("refresh token after reset: status = %d, want %d", w.Code, http.StatusUnauthorized)
+		}
+	}
+
+	if w := ts.do(t, http.MethodPost, "/api/login", "", map[string]string{"email": email, "password": "old password"}); w.Code != http.StatusUnauthorized {
+		t.Errorf("login with the old password: status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	ts.login(t, email, "new password")
+}
+
+func TestPasswordResetExpired(t *testing.T) {
+	ts := newTestServer(t)
+	const email = "jesse@example.com"
+	ts.signup(t, email, "old password")
+
+	token := requestReset(t, ts, email, map[string]bool{})
+	_, err := ts.db.ResetPassword(token, "new password", time.Now().Add(passwordResetTTL))
+	if !errors.Is(err, d.ErrNotFound) {
+		t.Fatalf("ResetPassword after expiry: err = %v, want ErrNotFound", err)
+	}
+
+	// The expired token is gone, so the endpoint refuses it too
+	w := ts.do(t, http.MethodPost, "/api/password-reset/confirm", "", map[string]string{"token": token, "password": "new password"})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("confirm after expiry: status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	ts.login(t, email, "old password")
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	. "github.com/mohamed2394/goserver/internal"
+	. "github.com/mohamed2394/goserver/internal/database"
+)
+
+const (
+	minPollOptions      = 2
+	maxPollOptions      = 4
+	maxPollOptionLength = 25
+)
+
+// newPoll validates a poll request for a chirp published at opensAt
+func newPoll(req *PollRequest, opensAt time.Time) (*Poll, error) {
+	if len(req.Options) < minPollOptions || len(req.Options) > maxPollOptions {
+		return nil, errors.New("A poll needs between 2 and 4 options")
+	}
+	if !req.ClosesAt.After(opensAt) {
+		return nil, errors.New("Poll closes_at must be after the chirp is published")
+	}
+
+	poll := &Poll{ClosesAt: req.ClosesAt.UTC()}
+	for _, text := range req.Options {
+		text = strings.TrimSpace(text)
+		if text == "" || len(text) > maxPollOptionLength {
+			return nil, errors.New("Poll options must be between 1 and 25 characters")
+		}
+		poll.Options = append(poll.Options, PollOption{Text: replaceProfaneWords(text, profaneWords)})
+	}
+	return poll, nil
+}
+
+func (ch *chirpHandler) votePollHandler(w http.ResponseWriter, r *http.Request) {
+	userId := currentUserId(r)
+	viewer, err := ch.newViewer(userId)
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to load chirp")
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("CHIRPID"))
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid chirp ID")
+		return
+	}
+
+	var reqBody VoteRequest
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	chirp, err := ch.db.GetChirp(id)
+	if err != nil || !viewer.canSee(chirp) {
+		RespondWithError(w, http.StatusNotFound, "Chirp not found")
+		return
+	}
+
+	chirp, err = ch.db.VotePoll(id, userId, reqBody.Option)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		RespondWithError(w, http.StatusNotFound, "Chirp not found")
+	case errors.Is(err, ErrNoPoll):
+		RespondWithError(w, http.StatusNotFound, "Chirp has no poll")
+	case errors.Is(err, ErrInvalidOption):
+		RespondWithError(w, http.StatusBadRequest, "Invalid poll option")
+	case errors.Is(err, ErrPollClosed):
+		RespondWithError(w, http.StatusConflict, "Poll is closed")
+	case errors.Is(err, ErrAlreadyVoted):
+		RespondWithError(w, http.StatusConflict, "You have already voted in this poll")
+	case err != nil:
+		log.Printf("Failed to record vote: %v", err)
+		RespondWithError(w, http.StatusInternalServerError, "Failed to record vote")
+	default:
+		RespondWithJSON(w, http.StatusCreated, chirp)
+	}
+}
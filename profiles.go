@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	. "github.com/mohamed2394/goserver/internal"
+	. "github.com/mohamed2394/goserver/internal/database"
+)
+
+const (
+	maxDisplayNameLength = 50
+	maxBioLength         = 160
+	maxAvatarURLLength   = 500
+)
+
+var handlePattern = regexp.MustCompile(`^[A-Za-z0-9_]{3,15}$`)
+
+var errInvalidHandle = errors.New("Handle must be 3-15 letters, digits or underscores")
+
+func validHandle(handle string) bool {
+	return handlePattern.MatchString(handle)
+}
+
+// validateProfileRequest checks the fields present in req, trimming the free text ones
+func validateProfileRequest(req *ProfileRequest) error {
+	if req.Handle != nil && !validHandle(*req.Handle) {
+		return errInvalidHandle
+	}
+	if req.DisplayName != nil {
+		*req.DisplayName = strings.TrimSpace(*req.DisplayName)
+		if len(*req.DisplayName) > maxDisplayNameLength {
+			return errors.New("Display name is too long")
+		}
+	}
+	if req.Bio != nil {
+		*req.Bio = strings.TrimSpace(*req.Bio)
+		if len(*req.Bio) > maxBioLength {
+			return errors.New("Bio is too long")
+		}
+	}
+	if req.AvatarURL != nil && *req.AvatarURL != "" {
+		avatar, err := url.Parse(*req.AvatarURL)
+		if err != nil || (avatar.Scheme != "http" && avatar.Scheme != "https") || avatar.Host == "" ||
+			len(*req.AvatarURL) > maxAvatarURLLength {
+			return errors.New("Avatar URL must be an http or https URL")
+		}
+	}
+	return nil
+}
+
+func (uh *userHandler) getUserProfileHandler(w http.ResponseWriter, r *http.Request) {
+	userId, err := strconv.Atoi(r.PathValue("USERID"))
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	profile, err := uh.db.GetUserProfile(userId)
+	if errors.Is(err, ErrNotFound) {
+		RespondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to load user")
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, profile)
+}
+
+func (uh *userHandler) getUserByHandleHandler(w http.ResponseWriter, r *http.Request) {
+	profile, err := uh.db.GetUserProfileByHandle(r.PathValue("HANDLE"))
+	if errors.Is(err, ErrNotFound) {
+		RespondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to load user")
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, profile)
+}
+
+func (uh *userHandler) updateProfileHandler(w http.ResponseWriter, r *http.Request) {
+	userId := currentUserId(r)
+
+	var reqBody ProfileRequest
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+	if err := validateProfileRequest(&reqBody); err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	profile, err := uh.db.UpdateProfile(userId, reqBody)
+	switch {
+	case errors.Is(err, ErrHandleTaken):
+		RespondWithError(w, http.StatusConflict, "Handle is already taken")
+	case errors.Is(err, ErrHandleCooldown):
+		msg := fmt.Sprintf("You can only change your handle once every %d days", int(HandleChangeCooldown.Hours()/24))
+		RespondWithError(w, http.StatusConflict, msg)
+	case errors.Is(err, ErrNotFound):
+		RespondWithError(w, http.StatusNotFound, "User not found")
+	case err != nil:
+		log.Printf("Failed to update profile: %v", err)
+		RespondWithError(w, http.StatusInternalServerError, "Failed to update profile")
+	default:
+		RespondWithJSON(w, http.StatusOK, profile)
+	}
+}
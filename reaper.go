@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	. "github.com/mohamed2394/goserver/internal/database"
+)
+
+const (
+	reaperInterval  = 30 * time.Second
+	reaperBatchSize = 100
+)
+
+// chirpReaper purges expired ephemeral chirps from the database. It deletes
+// them in small batches, each in its own write, so that request handlers
+// waiting on the database lock are never held up for a whole sweep.
+type chirpReaper struct {
+	db     *DB
+	events *chirpEvents
+	done   chan struct{}
+}
+
+func newChirpReaper(db *DB, events *chirpEvents) *chirpReaper {
+	return &chirpReaper{
+		db:     db,
+		events: events,
+		done:   make(chan struct{}),
+	}
+}
+
+// Start runs the reaper in the background until ctx is cancelled
+func (cr *chirpReaper) Start(ctx context.Context) {
+	go cr.run(ctx)
+}
+
+// Done is closed once the reaper has stopped
+func (cr *chirpReaper) Done() <-chan struct{} {
+	return cr.done
+}
+
+func (cr *chirpReaper) run(ctx context.Context) {
+	defer close(cr.done)
+
+	ticker := time.NewTicker(reaperInterval)
+	defer ticker.Stop()
+
+	for {
+		cr.sweep(ctx, time.Now())
+
+		select {
+		case <-ctx.Done():
+			log.Println("Reaper stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sweep deletes every chirp that expired by now
+func (cr *chirpReaper) sweep(ctx context.Context, now time.Time) {
+	ids, err := cr.db.GetExpiredChirpIds(now)
+	if err != nil {
+		log.Printf("Reaper failed to load expired chirps: %v", err)
+		return
+	}
+
+	for len(ids) > 0 && ctx.Err() == nil {
+		batch := ids[:min(reaperBatchSize, len(ids))]
+		ids = ids[len(batch):]
+
+		deleted, err := cr.db.DeleteChirps(batch)
+		if err != nil {
+			log.Printf("Reaper failed to delete expired chirps: %v", err)
+			return
+		}
+		for _, chirp := range deleted {
+			cr.events.Publish(chirpEvent{Type: chirpDeleted, Chirp: chirp})
+		}
+		log.Printf("Reaper purged %d expired chirps", len(deleted))
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/mohamed2394/goserver/internal/auth"
+	. "github.com/mohamed2394/goserver/internal/database"
+)
+
+// tokenRevocations decides which verified access tokens are no longer
+// honoured: tokens on the jti denylist, and tokens issued before their user's
+// current token version. Both are kept in memory for the auth path and
+// written through to the database so they survive a restart.
+type tokenRevocations struct {
+	db *DB
+	// leeway is how long past exp the verifier still accepts a token, so
+	// denylist entries are kept that much longer
+	leeway time.Duration
+
+	mu       sync.RWMutex
+	denied   map[string]time.Time
+	versions map[int]int
+}
+
+// newTokenRevocations loads the denylist and token versions from db
+func newTokenRevocations(db *DB, leeway time.Duration) (*tokenRevocations, error) {
+	denied, err := db.GetRevokedAccessTokens(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	versions, err := db.GetTokenVersions()
+	if err != nil {
+		return nil, err
+	}
+	return &tokenRevocations{
+		db:       db,
+		leeway:   leeway,
+		denied:   denied,
+		versions: versions,
+	}, nil
+}
+
+// Revoked reports whether the token with claims has been revoked
+func (tr *tokenRevocations) Revoked(claims auth.Claims) bool {
+	tr.mu.RLock()
+	defer tr.mu.RUnlock()
+
+	if _, ok := tr.denied[claims.Id]; ok {
+		return true
+	}
+	return claims.Version < tr.versions[claims.UserId]
+}
+
+// Version returns the token version new access tokens of userId are issued at
+func (tr *tokenRevocations) Version(userId int) int {
+	tr.mu.RLock()
+	defer tr.mu.RUnlock()
+	return tr.versions[userId]
+}
+
+// RevokeToken denylists the token with claims until it expires
+func (tr *tokenRevocations) RevokeToken(claims auth.Claims) error {
+	now := time.Now()
+	expiresAt := claims.ExpiresAt.Add(tr.leeway)
+	if err := tr.db.RevokeAccessToken(claims.Id, expiresAt, now); err != nil {
+		return err
+	}
+
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	for jti, exp := range tr.denied {
+		if !now.Before(exp) {
+			delete(tr.denied, jti)
+		}
+	}
+	tr.denied[claims.Id] = expiresAt
+	return nil
+}
+
+// RevokeAll invalidates every access token issued to userId so far
+func (tr *tokenRevocations) RevokeAll(userId int) error {
+	version, err := tr.db.BumpTokenVersion(userId)
+	if err != nil {
+		return err
+	}
+
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	tr.versions[userId] = version
+	return nil
+}
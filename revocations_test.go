@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mohamed2394/goserver/internal/auth"
+)
+
+func TestLogoutRevokesOnlyItsToken(t *testing.T) {
+	ts := newTestServer(t)
+	first := ts.signup(t, "walt@example.com", "password")
+	second := ts.login(t, "walt@example.com", "password")
+
+	if w := ts.do(t, http.MethodPost, "/api/logout", first.Token, nil); w.Code != http.StatusNoContent {
+		t.Fatalf("logout: %d %s", w.Code, w.Body)
+	}
+
+	if w := ts.do(t, http.MethodGet, "/api/sessions", first.Token, nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("logged out token: status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	if w := ts.do(t, http.MethodGet, "/api/sessions", second.Token, nil); w.Code != http.StatusOK {
+		t.Errorf("other token of the same user: status = %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestLogoutEverywhereRevokesAllTokens(t *testing.T) {
+	ts := newTestServer(t)
+	first := ts.signup(t, "walt@example.com", "password")
+	second := ts.login(t, "walt@example.com", "password")
+	other := ts.signup(t, "jesse@example.com", "password")
+
+	if w := ts.do(t, http.MethodDelete, "/api/sessions", first.Token, nil); w.Code != http.StatusNoContent {
+		t.Fatalf("delete all sessions: %d %s", w.Code, w.Body)
+	}
+
+	for _, login := range []testLogin{first, second} {
+		if w := ts.do(t, http.MethodGet, "/api/sessions", login.Token, nil); w.Code != http.StatusUnauthorized {
+			t.Errorf("token issued before the version bump: status = %d, want %d", w.Code, http.StatusUnauthorized)
+		}
+	}
+	if w := ts.do(t, http.MethodGet, "/api/sessions", other.Token, nil); w.Code != http.StatusOK {
+		t.Errorf("token of another user: status = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	// Tokens issued after the bump are accepted again
+	fresh := ts.login(t, "walt@example.com", "password")
+	if w := ts.do(t, http.MethodGet, "/api/sessions", fresh.Token, nil); w.Code != http.StatusOK {
+		t.Errorf("token issued after the version bump: status = %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestTokenRevocationsSurviveRestart(t *testing.T) {
+	ts := newTestServer(t)
+	userId := ts.signup(t, "walt@example.com", "password").Id
+	revocations, err := newTokenRevocations(ts.db, time.Minute)
+	if err != nil {
+		t.Fatalf("newTokenRevocations: %v", err)
+	}
+
+	denied := auth.Claims{Id: "denied", UserId: userId, ExpiresAt: time.Now().Add(time.Hour)}
+	kept := auth.Claims{Id: "kept", UserId: userId, Version: 1, ExpiresAt: time.Now().Add(time.Hour)}
+	if err := revocations.RevokeToken(denied); err != nil {
+		t.Fatalf("RevokeToken: %v", err)
+	}
+	if err := revocations.RevokeAll(userId); err != nil {
+		t.Fatalf("RevokeAll: %v", err)
+	}
+
+	reloaded, err := newTokenRevocations(ts.db, time.Minute)
+	if err != nil {
+		t.Fatalf("newTokenRevocations: %v", err)
+	}
+	for _, tr := range []*tokenRevocations{revocations, reloaded} {
+		if !tr.Revoked(denied) {
+			t.Error("denylisted token accepted")
+		}
+		if tr.Revoked(kept) {
+			t.Error("token at the current version rejected")
+		}
+		if stale := (auth.Claims{Id: "stale", UserId: userId, ExpiresAt: time.Now().Add(time.Hour)}); !tr.Revoked(stale) {
+			t.Error("token issued before RevokeAll accepted")
+		}
+	}
+}
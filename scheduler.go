@@ -0,0 +1,162 @@
+package main
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	. "github.com/mohamed2394/goserver/internal"
+	. "github.com/mohamed2394/goserver/internal/database"
+)
+
+// retryDelay is how long the scheduler waits before retrying a chirp that
+// failed to publish
+const retryDelay = 30 * time.Second
+
+// chirpScheduler publishes scheduled chirps once their publish time arrives.
+// Pending chirps live in the database; the scheduler only keeps an in-memory
+// queue of ids and times, which it rebuilds from the database on Start.
+type chirpScheduler struct {
+	db     *DB
+	events *chirpEvents
+	mu     sync.Mutex
+	queue  scheduleQueue
+	wake   chan struct{}
+	done   chan struct{}
+}
+
+type scheduleItem struct {
+	id        int
+	publishAt time.Time
+}
+
+func newChirpScheduler(db *DB, events *chirpEvents) *chirpScheduler {
+	return &chirpScheduler{
+		db:     db,
+		events: events,
+		wake:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+}
+
+// Start reloads the pending chirps from the database and runs the publisher
+// in the background until ctx is cancelled
+func (s *chirpScheduler) Start(ctx context.Context) error {
+	pending, err := s.db.GetPendingScheduledChirps()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	for _, sc := range pending {
+		heap.Push(&s.queue, scheduleItem{id: sc.Id, publishAt: sc.PublishAt})
+	}
+	s.mu.Unlock()
+	log.Printf("Scheduler loaded %d pending chirps", len(pending))
+
+	go s.run(ctx)
+	return nil
+}
+
+// Done is closed once the publisher has stopped
+func (s *chirpScheduler) Done() <-chan struct{} {
+	return s.done
+}
+
+// Schedule queues a chirp that has already been stored in the database
+func (s *chirpScheduler) Schedule(sc ScheduledChirp) {
+	s.mu.Lock()
+	heap.Push(&s.queue, scheduleItem{id: sc.Id, publishAt: sc.PublishAt})
+	s.mu.Unlock()
+
+	// Wake the publisher in case this chirp is due before the one it is waiting on
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *chirpScheduler) run(ctx context.Context) {
+	defer close(s.done)
+
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	for {
+		s.publishDue(time.Now())
+
+		timer.Reset(s.nextWait())
+		select {
+		case <-ctx.Done():
+			log.Println("Scheduler stopped")
+			return
+		case <-s.wake:
+		case <-timer.C:
+		}
+	}
+}
+
+// publishDue publishes every queued chirp whose time has come
+func (s *chirpScheduler) publishDue(now time.Time) {
+	for {
+		s.mu.Lock()
+		if s.queue.Len() == 0 || s.queue[0].publishAt.After(now) {
+			s.mu.Unlock()
+			return
+		}
+		item := heap.Pop(&s.queue).(scheduleItem)
+		s.mu.Unlock()
+
+		chirp, err := s.db.PublishScheduledChirp(item.id)
+		if errors.Is(err, ErrNotFound) {
+			// Cancelled by its author after it was queued
+			continue
+		}
+		if errors.Is(err, ErrNotGroupMember) {
+			// The author left the group, so the chirp was dropped, not retried
+			log.Printf("Dropped scheduled chirp %d: %v", item.id, err)
+			continue
+		}
+		if err != nil {
+			log.Printf("Failed to publish scheduled chirp %d: %v", item.id, err)
+			s.mu.Lock()
+			heap.Push(&s.queue, scheduleItem{id: item.id, publishAt: now.Add(retryDelay)})
+			s.mu.Unlock()
+			continue
+		}
+		s.events.Publish(chirpEvent{Type: chirpCreated, Chirp: chirp})
+	}
+}
+
+// nextWait returns how long to sleep until the next chirp is due
+func (s *chirpScheduler) nextWait() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.queue.Len() == 0 {
+		return time.Hour
+	}
+	wait := time.Until(s.queue[0].publishAt)
+	if wait < 0 {
+		return 0
+	}
+	return wait
+}
+
+// scheduleQueue is a min-heap of scheduled chirps ordered by publish time
+type scheduleQueue []scheduleItem
+
+func (q scheduleQueue) Len() int           { return len(q) }
+func (q scheduleQueue) Less(i, j int) bool { return q[i].publishAt.Before(q[j].publishAt) }
+func (q scheduleQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+
+func (q *scheduleQueue) Push(x any) { *q = append(*q, x.(scheduleItem)) }
+
+func (q *scheduleQueue) Pop() any {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
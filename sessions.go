@@ -0,0 +1,145 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	. "github.com/mohamed2394/goserver/internal"
+	. "github.com/mohamed2394/goserver/internal/database"
+)
+
+// maxDeviceLabelLength is the longest device label kept, in bytes
+const maxDeviceLabelLength = 100
+
+// startSession creates a session for userId on the device making r and
+// returns its refresh token. Refreshes issue access tokens of the lifetime
+// asked for with expiresInSeconds.
+func (uh *userHandler) startSession(r *http.Request, userId int, deviceLabel string, expiresInSeconds int) (string, Session, error) {
+	refreshToken, err := newOpaqueToken()
+	if err != nil {
+		return "", Session{}, err
+	}
+
+	if deviceLabel == "" {
+		deviceLabel = r.UserAgent()
+	}
+	if len(deviceLabel) > maxDeviceLabelLength {
+		deviceLabel = deviceLabel[:maxDeviceLabelLength]
+	}
+
+	session, err := uh.db.CreateSession(Session{
+		UserId:      userId,
+		DeviceLabel: deviceLabel,
+		IP:          clientIP(r),
+		UserAgent:   r.UserAgent(),
+		ExpiresAt:   time.Now().Add(uh.apiCfg.ttls.Refresh).UTC(),
+
+		ExpiresInSeconds: expiresInSeconds,
+	}, refreshToken)
+	if err != nil {
+		return "", Session{}, err
+	}
+	return refreshToken, session, nil
+}
+
+// newOpaqueToken returns a random token for refresh tokens and one-time
+// links. Only its hash is stored.
+func newOpaqueToken() (string, error) {
+	refresh := make([]byte, 32)
+	if _, err := rand.Read(refresh); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(refresh), nil
+}
+
+// clientIP returns the address of the client connected to the server
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func (uh *userHandler) getSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	userId := currentUserId(r)
+
+	sessions, err := uh.db.GetSessions(userId)
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to load sessions")
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, sessions)
+}
+
+func (uh *userHandler) deleteSessionHandler(w http.ResponseWriter, r *http.Request) {
+	userId := currentUserId(r)
+	id, err := strconv.Atoi(r.PathValue("SESSIONID"))
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid session ID")
+		return
+	}
+
+	err = uh.db.DeleteSession(id, userId)
+	if errors.Is(err, ErrNotFound) {
+		RespondWithError(w, http.StatusNotFound, "Session not found")
+		return
+	}
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to revoke session")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// logoutHandler revokes the access token the request was made with
+func (uh *userHandler) logoutHandler(w http.ResponseWriter, r *http.Request) {
+	p, _ := principalFrom(r.Context())
+
+	if err := uh.apiCfg.revocations.RevokeToken(p.Token); err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to revoke token")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deleteAllSessionsHandler logs the user out everywhere: every session is
+// revoked, so no device can refresh its access token any more, and every
+// access token issued so far stops being accepted
+func (uh *userHandler) deleteAllSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	userId := currentUserId(r)
+
+	count, err := uh.db.DeleteUserSessions(userId)
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to revoke sessions")
+		return
+	}
+	if err := uh.apiCfg.revocations.RevokeAll(userId); err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to revoke tokens")
+		return
+	}
+	log.Printf("Revoked %d sessions and all access tokens of user %d", count, userId)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (uh *userHandler) getSecurityEventsHandler(w http.ResponseWriter, r *http.Request) {
+	userId := currentUserId(r)
+
+	events, err := uh.db.GetSecurityEvents(userId)
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to load security events")
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, events)
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	. "github.com/mohamed2394/goserver/internal"
+	. "github.com/mohamed2394/goserver/internal/database"
+)
+
+const (
+	// maxSuggestions is how many ranked suggestions are kept per user
+	maxSuggestions = 50
+	// suggestionsTTL is the age at which a user's suggestions are recomputed
+	suggestionsTTL = 10 * time.Minute
+	// suggestionsIdleTimeout is how long suggestions are kept for a user who
+	// stopped asking for them
+	suggestionsIdleTimeout     = time.Hour
+	suggestionsRefreshInterval = time.Minute
+)
+
+// suggestionCache holds the "who to follow" ranking of each user who asked for
+// it recently. Ranking scans the whole graph, so a request only computes it on
+// a miss; stale entries keep being served while a background worker
+// recomputes them.
+type suggestionCache struct {
+	db      *DB
+	mu      sync.Mutex
+	entries map[int]*suggestionEntry
+	done    chan struct{}
+}
+
+type suggestionEntry struct {
+	suggestions []UserSuggestion
+	computedAt  time.Time
+	requestedAt time.Time
+}
+
+func newSuggestionCache(db *DB) *suggestionCache {
+	return &suggestionCache{
+		db:      db,
+		entries: make(map[int]*suggestionEntry),
+		done:    make(chan struct{}),
+	}
+}
+
+// Start runs the refresher in the background until ctx is cancelled
+func (sc *suggestionCache) Start(ctx context.Context) {
+	go sc.run(ctx)
+}
+
+// Done is closed once the refresher has stopped
+func (sc *suggestionCache) Done() <-chan struct{} {
+	return sc.done
+}
+
+// Get returns the cached suggestions for userId, computing them on a miss
+func (sc *suggestionCache) Get(userId int) ([]UserSuggestion, error) {
+	now := time.Now()
+
+	sc.mu.Lock()
+	entry, ok := sc.entries[userId]
+	if ok {
+		entry.requestedAt = now
+		suggestions := entry.suggestions
+		sc.mu.Unlock()
+		return suggestions, nil
+	}
+	sc.mu.Unlock()
+
+	suggestions, err := sc.db.SuggestUsers(userId, now, maxSuggestions)
+	if err != nil {
+		return nil, err
+	}
+
+	sc.mu.Lock()
+	sc.entries[userId] = &suggestionEntry{
+		suggestions: suggestions,
+		computedAt:  now,
+		requestedAt: now,
+	}
+	sc.mu.Unlock()
+	return suggestions, nil
+}
+
+func (sc *suggestionCache) run(ctx context.Context) {
+	defer close(sc.done)
+
+	ticker := time.NewTicker(suggestionsRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("Suggestion refresher stopped")
+			return
+		case <-ticker.C:
+			sc.refresh(ctx, time.Now())
+		}
+	}
+}
+
+// refresh drops idle entries and recomputes the ones older than suggestionsTTL
+func (sc *suggestionCache) refresh(ctx context.Context, now time.Time) {
+	var stale []int
+	sc.mu.Lock()
+	for userId, entry := range sc.entries {
+		switch {
+		case now.Sub(entry.requestedAt) > suggestionsIdleTimeout:
+			delete(sc.entries, userId)
+		case now.Sub(entry.computedAt) > suggestionsTTL:
+			stale = append(stale, userId)
+		}
+	}
+	sc.mu.Unlock()
+
+	for _, userId := range stale {
+		if ctx.Err() != nil {
+			return
+		}
+		suggestions, err := sc.db.SuggestUsers(userId, now, maxSuggestions)
+		if err != nil {
+			log.Printf("Failed to refresh suggestions for user %d: %v", userId, err)
+			continue
+		}
+		sc.mu.Lock()
+		if entry, ok := sc.entries[userId]; ok {
+			entry.suggestions = suggestions
+			entry.computedAt = now
+		}
+		sc.mu.Unlock()
+	}
+}
+
+type suggestionHandler struct {
+	db          *DB
+	apiCfg      *apiConfig
+	suggestions *suggestionCache
+}
+
+func (sh *suggestionHandler) getUserSuggestionsHandler(w http.ResponseWriter, r *http.Request) {
+	userId := currentUserId(r)
+	page, err := parsePage(r)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	suggestions, err := sh.suggestions.Get(userId)
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to load suggestions")
+		return
+	}
+
+	// The cached ranking may predate the user's latest follows, blocks and
+	// mutes, so those are applied again on every request
+	relations, err := sh.db.GetRelations(userId)
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to load suggestions")
+		return
+	}
+	current := make([]UserSuggestion, 0, len(suggestions))
+	for _, suggestion := range suggestions {
+		id := suggestion.Id
+		if relations.Following[id] || relations.Blocked[id] || relations.BlockedBy[id] || relations.Muted[id] {
+			continue
+		}
+		current = append(current, suggestion)
+	}
+
+	RespondWithJSON(w, http.StatusOK, paginate(current, page))
+}
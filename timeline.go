@@ -0,0 +1,66 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	. "github.com/mohamed2394/goserver/internal"
+	. "github.com/mohamed2394/goserver/internal/database"
+)
+
+// fanOutThreshold is the follower count above which an author's chirps are
+// no longer copied into every follower's inbox on write. Timelines pull
+// those authors' chirps on read instead, so posting stays cheap for them.
+const fanOutThreshold = 1000
+
+// homeTimeline delivers new chirps into the inboxes of their author and,
+// for accounts up to fanOutThreshold followers, of their followers
+type homeTimeline struct {
+	db *DB
+}
+
+// onChirpEvent is subscribed to the chirp event bus
+func (ht *homeTimeline) onChirpEvent(event chirpEvent) {
+	if event.Type != chirpCreated {
+		return
+	}
+	if err := ht.fanOut(event.Chirp); err != nil {
+		log.Printf("Failed to fan out chirp %d: %v", event.Chirp.Id, err)
+	}
+}
+
+func (ht *homeTimeline) fanOut(chirp Chirp) error {
+	recipients := []int{chirp.AuthorId}
+
+	followers, err := ht.db.GetFollowerIds(chirp.AuthorId)
+	if err != nil {
+		return err
+	}
+	if len(followers) <= fanOutThreshold {
+		recipients = append(recipients, followers...)
+	}
+
+	return ht.db.DeliverToInboxes(chirp.Id, recipients)
+}
+
+func (ch *chirpHandler) getTimelineHandler(w http.ResponseWriter, r *http.Request) {
+	userId := currentUserId(r)
+	page, err := parseChirpPage(r)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	viewer, err := ch.newViewer(userId)
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to load timeline")
+		return
+	}
+	chirps, err := ch.db.GetTimelineChirps(userId, fanOutThreshold)
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to load timeline")
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, page.applyNewestFirst(viewer.filterFeed(chirps)))
+}
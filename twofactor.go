@@ -0,0 +1,234 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	. "github.com/mohamed2394/goserver/internal"
+	. "github.com/mohamed2394/goserver/internal/database"
+	"github.com/mohamed2394/goserver/internal/totp"
+)
+
+const (
+	// mfaChallengeTTL is how long a login has to provide its second factor
+	mfaChallengeTTL = 5 * time.Minute
+	// recoveryCodeCount is how many recovery codes a user gets on enrolment
+	recoveryCodeCount = 10
+	// totpIssuer names the service in authenticator apps
+	totpIssuer = "Chirpy"
+)
+
+// checkTOTP validates authenticator codes at the current time
+func checkTOTP(secret, code string, after int64) (int64, bool) {
+	return totp.Validate(secret, code, time.Now(), after)
+}
+
+// startMFAChallenge responds to a login whose password was right with a
+// challenge token to complete it with the second factor
+func (uh *userHandler) startMFAChallenge(w http.ResponseWriter, userId int, req UserRequest) {
+	token, err := newOpaqueToken()
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Error generating MFA token")
+		return
+	}
+
+	now := time.Now().UTC()
+	challenge := MFAChallenge{
+		UserId:           userId,
+		DeviceLabel:      req.DeviceLabel,
+		ExpiresInSeconds: req.ExpiresInSeconds,
+		CreatedAt:        now,
+		ExpiresAt:        now.Add(mfaChallengeTTL),
+	}
+	if err := uh.db.CreateMFAChallenge(challenge, token); err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Error generating MFA token")
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"mfa_required": true,
+		"mfa_token":    token,
+		"expires_at":   challenge.ExpiresAt,
+	})
+}
+
+// loginTwoFactorHandler finishes a login with the MFA token it returned and
+// an authenticator or recovery code
+func (uh *userHandler) loginTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	var reqBody MFALoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+	if reqBody.MFAToken == "" || (reqBody.Code == "" && reqBody.RecoveryCode == "") {
+		RespondWithError(w, http.StatusBadRequest, "MFA token and a code or recovery code are required")
+		return
+	}
+
+	challenge, err := uh.db.CompleteMFAChallenge(reqBody.MFAToken, reqBody.TwoFactorRequest, checkTOTP, time.Now())
+	if errors.Is(err, ErrNotFound) {
+		RespondWithError(w, http.StatusUnauthorized, "Invalid or expired MFA token")
+		return
+	}
+	if errors.Is(err, ErrInvalidCode) || errors.Is(err, ErrTwoFactorNotEnabled) {
+		RespondWithError(w, http.StatusUnauthorized, "Invalid code")
+		return
+	}
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to verify code")
+		return
+	}
+	if reqBody.RecoveryCode != "" {
+		log.Printf("User %d logged in with a recovery code", challenge.UserId)
+	}
+
+	user, err := uh.db.GetUserById(challenge.UserId)
+	if err != nil {
+		RespondWithError(w, http.StatusUnauthorized, "Invalid or expired MFA token")
+		return
+	}
+	uh.completeLogin(w, r, user, challenge.DeviceLabel, challenge.ExpiresInSeconds)
+}
+
+func (uh *userHandler) getTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	userId := currentUserId(r)
+
+	tf, err := uh.db.GetTwoFactor(userId)
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to load two-factor settings")
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"enabled":                  tf.Enabled(),
+		"enabled_at":               tf.EnabledAt,
+		"recovery_codes_remaining": len(tf.RecoveryCodes),
+	})
+}
+
+// setupTwoFactorHandler hands out a new secret for the user to add to their
+// authenticator. Two-factor authentication is only enabled once a code from
+// it is confirmed.
+func (uh *userHandler) setupTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	userId := currentUserId(r)
+
+	user, err := uh.db.GetUserById(userId)
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to load user")
+		return
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to generate secret")
+		return
+	}
+
+	err = uh.db.StartTwoFactorSetup(userId, secret)
+	if errors.Is(err, ErrTwoFactorEnabled) {
+		RespondWithError(w, http.StatusConflict, "Two-factor authentication is already enabled")
+		return
+	}
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to start two-factor setup")
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"secret":      secret,
+		"otpauth_uri": totp.URI(secret, totpIssuer, user.Email),
+	})
+}
+
+// confirmTwoFactorHandler enables two-factor authentication with a code from
+// the authenticator set up, and responds with the recovery codes. They are
+// only ever shown here.
+func (uh *userHandler) confirmTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	userId := currentUserId(r)
+
+	var reqBody TwoFactorRequest
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+	if reqBody.Code == "" {
+		RespondWithError(w, http.StatusBadRequest, "Code is required")
+		return
+	}
+
+	recoveryCodes, err := newRecoveryCodes()
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to generate recovery codes")
+		return
+	}
+
+	err = uh.db.ConfirmTwoFactorSetup(userId, reqBody.Code, checkTOTP, recoveryCodes)
+	if errors.Is(err, ErrTwoFactorEnabled) {
+		RespondWithError(w, http.StatusConflict, "Two-factor authentication is already enabled")
+		return
+	}
+	if errors.Is(err, ErrNotFound) {
+		RespondWithError(w, http.StatusBadRequest, "Two-factor setup has not been started")
+		return
+	}
+	if errors.Is(err, ErrInvalidCode) {
+		RespondWithError(w, http.StatusBadRequest, "Invalid code")
+		return
+	}
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to enable two-factor authentication")
+		return
+	}
+	log.Printf("Two-factor authentication enabled for user %d", userId)
+
+	RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"recovery_codes": recoveryCodes,
+	})
+}
+
+// disableTwoFactorHandler turns two-factor authentication off, which takes
+// a current authenticator or recovery code
+func (uh *userHandler) disableTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	userId := currentUserId(r)
+
+	var reqBody TwoFactorRequest
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	err := uh.db.DisableTwoFactor(userId, reqBody, checkTOTP)
+	if errors.Is(err, ErrTwoFactorNotEnabled) {
+		RespondWithError(w, http.StatusConflict, "Two-factor authentication is not enabled")
+		return
+	}
+	if errors.Is(err, ErrInvalidCode) {
+		RespondWithError(w, http.StatusForbidden, "Invalid code")
+		return
+	}
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to disable two-factor authentication")
+		return
+	}
+	log.Printf("Two-factor authentication disabled for user %d", userId)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// newRecoveryCodes returns recoveryCodeCount random codes like "3f9a1-c07be"
+func newRecoveryCodes() ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		code := hex.EncodeToString(b)
+		codes[i] = code[:5] + "-" + code[5:]
+	}
+	return codes, nil
+}
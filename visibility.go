@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	. "github.com/mohamed2394/goserver/internal"
+	. "github.com/mohamed2394/goserver/internal/database"
+)
+
+var errInvalidVisibility = errors.New("visibility must be one of public, followers or private")
+
+// parseVisibility validates a requested visibility, defaulting to public
+func parseVisibility(visibility string) (string, error) {
+	switch visibility {
+	case "":
+		return VisibilityPublic, nil
+	case VisibilityPublic, VisibilityFollowers, VisibilityPrivate:
+		return visibility, nil
+	default:
+		return "", errInvalidVisibility
+	}
+}
+
+// chirpViewer decides which chirps the user making a request may read. All
+// chirp read paths go through it so the rules live in one place.
+type chirpViewer struct {
+	userId    int // 0 for anonymous viewers
+	relations Relations
+}
+
+// viewerFor returns the chirpViewer for the possibly anonymous user making r
+func (ch *chirpHandler) viewerFor(r *http.Request) (*chirpViewer, error) {
+	return ch.newViewer(currentUserId(r))
+}
+
+// newViewer returns the chirpViewer for userId, or for an anonymous viewer if it is 0
+func (ch *chirpHandler) newViewer(userId int) (*chirpViewer, error) {
+	return newChirpViewer(ch.db, userId)
+}
+
+func newChirpViewer(db *DB, userId int) (*chirpViewer, error) {
+	viewer := &chirpViewer{userId: userId}
+	if userId == 0 {
+		return viewer, nil
+	}
+
+	relations, err := db.GetRelations(userId)
+	if err != nil {
+		return nil, err
+	}
+	viewer.relations = relations
+	return viewer, nil
+}
+
+// canSee reports whether the viewer may read chirp
+func (v *chirpViewer) canSee(chirp Chirp) bool {
+	// Expired chirps are hidden until the reaper gets to them
+	if chirp.IsExpired(time.Now()) {
+		return false
+	}
+	if v.userId != 0 && chirp.AuthorId == v.userId {
+		return true
+	}
+	if v.relations.BlockedBy[chirp.AuthorId] {
+		return false
+	}
+	// Group chirps are only readable by the group's members, whatever their visibility
+	if chirp.GroupId != 0 {
+		return v.relations.Groups[chirp.GroupId]
+	}
+
+	switch chirp.Visibility {
+	case "", VisibilityPublic:
+		return true
+	case VisibilityFollowers:
+		return v.relations.Following[chirp.AuthorId]
+	default:
+		return false
+	}
+}
+
+// wantsInFeed reports whether chirp belongs in the viewer's chirp listing and
+// timeline. On top of canSee, it hides authors the viewer blocked or muted.
+func (v *chirpViewer) wantsInFeed(chirp Chirp) bool {
+	if v.relations.Blocked[chirp.AuthorId] || v.relations.Muted[chirp.AuthorId] {
+		return false
+	}
+	return v.canSee(chirp)
+}
+
+// filter returns the chirps the viewer may read, keeping their order
+func (v *chirpViewer) filter(chirps []Chirp) []Chirp {
+	return filterChirps(chirps, v.canSee)
+}
+
+// filterFeed returns the chirps that belong in the viewer's feeds, keeping their order
+func (v *chirpViewer) filterFeed(chirps []Chirp) []Chirp {
+	return filterChirps(chirps, v.wantsInFeed)
+}
+
+func filterChirps(chirps []Chirp, keep func(Chirp) bool) []Chirp {
+	kept := make([]Chirp, 0, len(chirps))
+	for _, chirp := range chirps {
+		if keep(chirp) {
+			kept = append(kept, chirp)
+		}
+	}
+	return kept
+}